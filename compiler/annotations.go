@@ -0,0 +1,267 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Annotations are options attached to a declaration, written as a bracketed
+// list after it ("[since=3, removed=5]"). An annotation without a value is a
+// flag, equivalent to setting it to true.
+
+// Known message field annotations.
+var fieldAnnotations = map[string]knownOption{
+	"since":     {ItemNumber, checkVersion, false},           // Schema version the field was added in.
+	"removed":   {ItemNumber, checkVersion, false},           // Schema version the field was removed in.
+	"min":       {ItemNumber, checkInteger, false},           // Smallest allowed value of numbers.
+	"max":       {ItemNumber, checkInteger, false},           // Largest allowed value of numbers.
+	"maxlen":    {ItemNumber, checkLength, false},            // Longest allowed string or dynamic array.
+	"pattern":   {ItemStringLiteral, checkPattern, false},    // Regular expression strings must match.
+	"unit":      {ItemStringLiteral, checkUnit, false},       // Unit of numbers, e.g. "mm".
+	"packed":    {ItemIdentifier, checkBool, false},          // Encode fixed size bool arrays as bitsets.
+	"when":      {ItemStringLiteral, checkConditions, false}, // Conditions the field is generated for.
+	"sensitive": {ItemIdentifier, checkBool, false},          // Redact the field when printing messages.
+}
+
+// Known choice alternative annotations.
+var choiceFieldAnnotations = map[string]knownOption{
+	"fallback": {ItemIdentifier, checkBool, false}, // Alternative selected for unknown tags.
+}
+
+// Parse an optional list of annotations. The values of known annotations are
+// checked.
+func (p *Parser) parseAnnotations(known map[string]knownOption) ([]Option, bool) {
+	if !p.accept(ItemLeftBracket) {
+		return nil, true
+	}
+	var annotations []Option
+	for {
+		if !p.expect(ItemIdentifier) {
+			return nil, false
+		}
+		name := p.prev
+		valueItem := Item{ItemIdentifier, "true", name.Pos}
+		if p.accept(ItemEqual) {
+			if !p.parseOptionValue() {
+				return nil, false
+			}
+			valueItem = p.prev
+		}
+		annotation := p.newOption(name, valueItem)
+		for _, a := range annotations {
+			if a.Name == annotation.Name {
+				p.semanticError(name, errors.New("duplicate annotation"))
+				return nil, false
+			}
+		}
+		if !p.check(valueItem, func(Item) error { return annotation.checkKnown(known) }) {
+			return nil, false
+		}
+		if _, ok := known[annotation.Name]; !ok && !p.parsingStd {
+			if p.unknownAnnotations == nil {
+				p.unknownAnnotations = make(map[string]int)
+			}
+			p.unknownAnnotations[annotation.Name]++
+		}
+		annotations = append(annotations, annotation)
+		if !p.accept(ItemComma) {
+			break
+		}
+	}
+	return annotations, p.expect(ItemRightBracket)
+}
+
+// Returns the annotation with the specified name or nil.
+func findAnnotation(annotations []Option, name string) *Option {
+	for i := range annotations {
+		if annotations[i].Name == name {
+			return &annotations[i]
+		}
+	}
+	return nil
+}
+
+// Check that a field is not removed before it's added by its since and removed
+// annotations. They are checked against the schema version by CheckVersions.
+func (p *Parser) checkVersionAnnotations(annotations []Option) bool {
+	since, removed := findAnnotation(annotations, "since"), findAnnotation(annotations, "removed")
+	if since != nil && removed != nil && versionNumber(since.Value) >= versionNumber(removed.Value) {
+		p.pushSemanticError(removed.errorCtx, errors.New("field removed before it was added"))
+		return false
+	}
+	return true
+}
+
+// Check that the since and removed annotations of message fields are not
+// newer than the schema version of their package, which may be declared by
+// any file of the package. The errors found are returned.
+func (p *Parser) CheckVersions() []error {
+	var errs []error
+	for _, pkg := range p.Packages() {
+		version := p.PackageOption(pkg.Name, "version")
+		for _, m := range pkg.Messages {
+			for _, f := range m.Fields {
+				for _, a := range []*Option{findAnnotation(f.Annotations, "since"), findAnnotation(f.Annotations, "removed")} {
+					var err error
+					if a != nil && version == "" {
+						err = fmt.Errorf("annotation %s requires the schema version to be declared (option version)", a.Name)
+					} else if a != nil && versionNumber(a.Value) > versionNumber(version) {
+						err = fmt.Errorf("annotation %s is newer than the schema version %s", a.Name, version)
+					}
+					if err != nil {
+						d := a.errorCtx.Error(err)
+						d.Semantic = true
+						errs = append(errs, d)
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func versionNumber(value string) uint64 {
+	n, _ := strconv.ParseUint(value, 10, 32)
+	return n
+}
+
+// Value ranges of number types.
+var numberRanges = map[ItemKind][2]*big.Int{
+	ItemByte:    uintRange(8),
+	ItemUint8:   uintRange(8),
+	ItemUint16:  uintRange(16),
+	ItemUint32:  uintRange(32),
+	ItemUint64:  uintRange(64),
+	ItemUint128: uintRange(128),
+	ItemInt8:    intRange(8),
+	ItemInt16:   intRange(16),
+	ItemInt32:   intRange(32),
+	ItemInt64:   intRange(64),
+	ItemInt128:  intRange(128),
+}
+
+// Returns the integer value range of a number type. Float types have no
+// range limiting integer constraints. The second value is false if the type
+// is not a number type.
+func numberRange(ft *FieldType) ([2]*big.Int, bool) {
+	switch ft.Basic {
+	case ItemFloat32, ItemFloat64:
+		return [2]*big.Int{}, true
+	case ItemFixed:
+		return intRange(uint(ft.IntBits)), true
+	case ItemUfixed:
+		return uintRange(uint(ft.IntBits)), true
+	}
+	r, ok := numberRanges[ft.Basic]
+	return r, ok
+}
+
+func uintRange(bits uint) [2]*big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), bits)
+	return [2]*big.Int{big.NewInt(0), max.Sub(max, big.NewInt(1))}
+}
+
+func intRange(bits uint) [2]*big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	min := new(big.Int).Neg(max)
+	return [2]*big.Int{min, max.Sub(max, big.NewInt(1))}
+}
+
+// Check that value is an integer.
+func checkInteger(value string) error {
+	if _, ok := new(big.Int).SetString(value, 10); !ok {
+		return errors.New("expected integer")
+	}
+	return nil
+}
+
+// Check that value is a positive length.
+func checkLength(value string) error {
+	if n, err := strconv.ParseUint(value, 10, 32); err != nil || n == 0 {
+		return errors.New("expected length in range [1,4294967295]")
+	}
+	return nil
+}
+
+// Check that value is a valid regular expression.
+func checkPattern(value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	return nil
+}
+
+// Check that value is a unit symbol such as "mm" or "m/s".
+func checkUnit(value string) error {
+	if value == "" || strings.IndexFunc(value, func(r rune) bool { return !unicode.IsGraphic(r) || r == ' ' }) >= 0 {
+		return errors.New("expected unit symbol without spaces")
+	}
+	return nil
+}
+
+// Check the min, max, maxlen, pattern, unit and packed annotations of a field
+// against each other and the type of the field.
+func (p *Parser) checkConstraintAnnotations(annotations []Option, ft *FieldType) bool {
+	min, max := findAnnotation(annotations, "min"), findAnnotation(annotations, "max")
+	typeRange, isNumber := numberRange(ft)
+	var bounds [2]*big.Int
+	for i, a := range []*Option{min, max} {
+		if a == nil {
+			continue
+		}
+		if !isNumber {
+			p.pushSemanticError(a.errorCtx, fmt.Errorf("annotation %s requires a number type", a.Name))
+			return false
+		}
+		bounds[i], _ = new(big.Int).SetString(a.Value, 10)
+		if typeRange[0] != nil && (bounds[i].Cmp(typeRange[0]) < 0 || bounds[i].Cmp(typeRange[1]) > 0) {
+			p.pushSemanticError(a.errorCtx, fmt.Errorf("annotation %s out of range [%v,%v]", a.Name, typeRange[0], typeRange[1]))
+			return false
+		}
+	}
+	if min != nil && max != nil && bounds[0].Cmp(bounds[1]) > 0 {
+		p.pushSemanticError(max.errorCtx, errors.New("annotation max is less than min"))
+		return false
+	}
+	if maxlen := findAnnotation(annotations, "maxlen"); maxlen != nil && ft.Array != ArrayDynamic && ft.Basic != ItemString && ft.Map == nil {
+		p.pushSemanticError(maxlen.errorCtx, errors.New("annotation maxlen requires a string, dynamic array or map type"))
+		return false
+	}
+	if unit := findAnnotation(annotations, "unit"); unit != nil && !isNumber {
+		p.pushSemanticError(unit.errorCtx, errors.New("annotation unit requires a number type"))
+		return false
+	}
+	if pattern := findAnnotation(annotations, "pattern"); pattern != nil && ft.Basic != ItemString {
+		p.pushSemanticError(pattern.errorCtx, errors.New("annotation pattern requires a string type"))
+		return false
+	}
+	if packed := findAnnotation(annotations, "packed"); packed != nil && packed.Bool() && (ft.Array != ArrayFixed || ft.Basic != ItemBool) {
+		p.pushSemanticError(packed.errorCtx, errors.New("annotation packed requires a fixed size bool array type"))
+		return false
+	}
+	return true
+}
+
+// Check that at most one alternative of a choice is the fallback.
+func (p *Parser) checkFallback(scope *choiceScope, annotations []Option) bool {
+	fallback := findAnnotation(annotations, "fallback")
+	if fallback == nil || !fallback.Bool() {
+		return true
+	}
+	if scope.fallback != nil {
+		p.pushSemanticError(fallback.errorCtx, fmt.Errorf("fallback alternative already declared at %s", scope.fallback.errorCtx.Position()))
+		return false
+	}
+	scope.fallback = fallback
+	return true
+}
@@ -0,0 +1,227 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Pos is a position in a speak source file.
+type Pos struct {
+	File   string // Name of the file.
+	Line   int    // Line number, starting at 1.
+	Column int    // Column number in characters, starting at 1.
+}
+
+// Position in "file:line:column" format.
+func (pos Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Column)
+}
+
+// Compare positions, files are ordered by name.
+func (pos Pos) compare(other Pos) int {
+	return cmp.Or(cmp.Compare(pos.File, other.File), cmp.Compare(pos.Line, other.Line), cmp.Compare(pos.Column, other.Column))
+}
+
+// Returns a semantic error located at the position, value is the text at the
+// position.
+func (pos Pos) semanticError(value string, details error) *Diagnostic {
+	return &Diagnostic{
+		File:     pos.File,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Msg:      fmt.Sprintf("at '%s', %s.", value, details),
+		Semantic: true,
+	}
+}
+
+// Package holds the declarations of all files of a package in declaration
+// order.
+type Package struct {
+	Name string
+
+	// Options of all files of the package. Package options set by several
+	// files are repeated.
+	Options []Option
+
+	Constants []*Constant
+	Messages  []*Message
+	Enums     []*Enum
+	Choices   []*Choice
+	Types     []*TypeAlias
+}
+
+// Constant is a named integer constant.
+type Constant struct {
+	Pos   Pos
+	Name  string
+	Value int64
+}
+
+// Message is a message declaration.
+type Message struct {
+	Pos        Pos
+	Name       string
+	Options    []Option
+	Fields     []*Field
+	Extensions []ExtensionRange
+}
+
+// Field is a message field.
+type Field struct {
+	Pos         Pos // Position of the field name.
+	Tag         uint64
+	Name        string
+	Type        FieldType
+	Optional    bool // Presence of the field is tracked.
+	Annotations []Option
+}
+
+// ExtensionRange is a range of message tags reserved for extensions.
+type ExtensionRange struct {
+	Pos         Pos
+	First, Last uint64
+}
+
+// Array kinds.
+type ArrayKind int
+
+const (
+	ArrayNone ArrayKind = iota
+	ArrayFixed
+	ArrayDynamic
+)
+
+// FieldType is the type of a message field, choice alternative, custom type
+// or map key or value. Exactly one of Basic, Type, Enum and Map is set.
+type FieldType struct {
+	Array     ArrayKind
+	ArraySize uint64            // Size of fixed arrays.
+	Basic     ItemKind          // Basic element type or zero.
+	IntBits   uint64            // Integer bits of fixed point types, including the sign bit.
+	FracBits  uint64            // Fractional bits of fixed point types.
+	Type      *FqTypeIdentifier // Named element type or nil.
+	Enum      *Enum             // Anonymous enum element type or nil.
+	Map       *MapType          // Map type of a message field or nil.
+
+	size *arraySize // Size of fixed arrays until constants are resolved.
+}
+
+// MapType is the type of a map field. Keys are integers, strings or enums.
+type MapType struct {
+	Key   FieldType
+	Value FieldType
+}
+
+// Enum is an enum declaration or an anonymous enum of a message field.
+type Enum struct {
+	Pos     Pos
+	Name    string // Empty for anonymous enums.
+	Options []Option
+	Values  []*EnumValue
+}
+
+// EnumValue is a named enum value.
+type EnumValue struct {
+	Pos   Pos // Position of the value name.
+	Name  string
+	Value uint64
+}
+
+// Choice is a choice declaration.
+type Choice struct {
+	Pos          Pos
+	Name         string
+	Alternatives []*ChoiceField
+}
+
+// ChoiceField is an alternative of a choice.
+type ChoiceField struct {
+	Pos         Pos // Position of the alternative name, or type if unnamed.
+	Tag         uint64
+	Name        string // Declared name or the default name derived from the type.
+	Type        FieldType
+	Annotations []Option
+}
+
+// TypeAlias is a custom type declaration.
+type TypeAlias struct {
+	Pos  Pos
+	Name string
+	Type FieldType
+}
+
+// FqTypeIdentifier is a reference to a named type.
+type FqTypeIdentifier struct {
+	PackageName string // Empty for types of the referring package until resolved.
+	TypeName    string
+}
+
+func (t *FqTypeIdentifier) String() string {
+	if t.PackageName == "" {
+		return t.TypeName
+	}
+	return t.PackageName + "." + t.TypeName
+}
+
+// Returns the position of an item.
+func (ctx *ErrorCtx) pos() Pos {
+	return Pos{ctx.lexer.Name, ctx.lexer.LineNumber(ctx.item), ctx.lexer.ColumnNumber(ctx.item)}
+}
+
+// Returns the position of an item from the current lexer.
+func (p *Parser) pos(item Item) Pos {
+	ctx := p.errorCtx(item)
+	return ctx.pos()
+}
+
+// Returns the package being parsed, it's created on first use.
+func (p *Parser) pkg() *Package {
+	if p.packages == nil {
+		p.packages = make(map[string]*Package)
+	}
+	pkg := p.packages[p.packageName]
+	if pkg == nil {
+		pkg = &Package{Name: p.packageName}
+		p.packages[p.packageName] = pkg
+	}
+	return pkg
+}
+
+// Compare the positions of the items of error contexts, files are ordered by
+// name.
+func (ctx *ErrorCtx) compare(other *ErrorCtx) int {
+	return cmp.Or(cmp.Compare(ctx.lexer.Name, other.lexer.Name), cmp.Compare(ctx.item.Pos, other.item.Pos))
+}
+
+// Sort the declarations of all parsed files by position, files ordered by
+// name, so that the syntax trees and the diagnostics of the checks made after
+// parsing do not depend on the order the files were parsed in.
+func (p *Parser) sortDeclarations() {
+	slices.SortStableFunc(p.types, func(a, b typeDecl) int { return a.errorCtx.compare(&b.errorCtx) })
+	for _, pkg := range p.packages {
+		slices.SortStableFunc(pkg.Options, func(a, b Option) int { return a.errorCtx.compare(&b.errorCtx) })
+		slices.SortStableFunc(pkg.Constants, func(a, b *Constant) int { return a.Pos.compare(b.Pos) })
+		slices.SortStableFunc(pkg.Messages, func(a, b *Message) int { return a.Pos.compare(b.Pos) })
+		slices.SortStableFunc(pkg.Enums, func(a, b *Enum) int { return a.Pos.compare(b.Pos) })
+		slices.SortStableFunc(pkg.Choices, func(a, b *Choice) int { return a.Pos.compare(b.Pos) })
+		slices.SortStableFunc(pkg.Types, func(a, b *TypeAlias) int { return a.Pos.compare(b.Pos) })
+	}
+}
+
+// Returns the packages parsed so far sorted by name, including the standard
+// package.
+func (p *Parser) Packages() []*Package {
+	var packages []*Package
+	for _, pkg := range p.packages {
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package compiler compiles speak interface definition files. It's used by
+// the speakc command and by tools that compile speak files in-process, such
+// as build tools and editors.
+//
+// Files are only read through Options.FS if it's set, which lets the package
+// run without a file system, e.g. compiled to WebAssembly (GOOS=js or
+// GOOS=wasip1) for use in a web browser.
+package compiler
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+// Source is a speak source file held in memory.
+type Source struct {
+	Name string // File name used when reporting errors.
+	Text string // Contents of the file.
+}
+
+// Options of a compilation.
+type Options struct {
+	// Target language (c|go).
+	Lang string
+
+	// Identifier cases used by the target language, see DefaultNaming.
+	Naming Naming
+
+	// Upper limit of fixed array sizes, DefaultMaxArraySize is used if zero.
+	MaxArraySize uint64
+
+	// Limits protecting against pathological input.
+	Limits Limits
+
+	// Progress is logged at level info and details useful when debugging
+	// the compiler at level debug, nothing is logged if nil.
+	Logger *slog.Logger
+
+	// Reject float64 types.
+	NoFloat64 bool
+
+	// Require maxlen annotations on strings and dynamic arrays.
+	RequireMaxLen bool
+
+	// Filled in with statistics of the compiled schemas unless nil or
+	// errors are found.
+	Stats *Stats
+
+	// Filled in with the durations of the compilation phases unless nil,
+	// also if errors are found.
+	Timings *Timings
+
+	// Speak files held in memory, compiled before Filenames.
+	Sources []Source
+
+	// Speak files read from the file system.
+	Filenames []string
+
+	// File system Filenames are read from, the operating system is used if
+	// nil. Names must then be unrooted slash separated paths, see io/fs.
+	FS fs.FS
+
+	// Directories searched for imported files after the directory of the
+	// importing file, in order.
+	IncludePaths []string
+}
+
+// File is a generated file.
+type File struct {
+	Name string // Path relative to the output directory.
+	Data []byte // Contents of the file.
+}
+
+// Files are the files generated by a compilation.
+type Files []File
+
+// Diagnostics are the errors found by a compilation, sorted by location.
+type Diagnostics []error
+
+// Compile speak files. The generated files and the errors found are returned,
+// no files are generated if errors are found. Code generators are not
+// implemented yet so the files are always empty.
+func Compile(opts *Options) (Files, Diagnostics) {
+	return CompileContext(context.Background(), opts)
+}
+
+// Same as Compile but stop when ctx is done, the error of ctx is then the
+// only error returned.
+func CompileContext(ctx context.Context, opts *Options) (Files, Diagnostics) {
+	_, errs := ParseContext(ctx, opts)
+	return nil, errs
+}
+
+// Parse and check speak files without generating code. The syntax trees of
+// the packages sorted by name, including the standard package, and the
+// errors found are returned. No packages are returned if errors are found.
+// Declarations are sorted by position with files ordered by name, the result
+// does not depend on the order of the files.
+func Parse(opts *Options) ([]*Package, Diagnostics) {
+	return ParseContext(context.Background(), opts)
+}
+
+// Same as Parse but stop when ctx is done, the error of ctx is then the only
+// error returned. Editors use it to abandon analysis of outdated text.
+func ParseContext(ctx context.Context, opts *Options) ([]*Package, Diagnostics) {
+	parser := &Parser{
+		ctx:           ctx,
+		Lang:          opts.Lang,
+		Naming:        opts.Naming,
+		MaxArraySize:  opts.MaxArraySize,
+		Limits:        opts.Limits,
+		Logger:        opts.Logger,
+		FS:            opts.FS,
+		IncludePaths:  opts.IncludePaths,
+		NoFloat64:     opts.NoFloat64,
+		RequireMaxLen: opts.RequireMaxLen,
+	}
+	parser.log().Debug("compiling", "lang", opts.Lang, "naming", opts.Naming, "maxArraySize", opts.MaxArraySize, "limits", opts.Limits)
+
+	start := time.Now()
+	if ok, errs := parser.ParseStd(); !ok {
+		panic(fmt.Sprintf("compiler: invalid standard package: %v", errs))
+	}
+	var errs []error
+	for _, source := range opts.Sources {
+		if ctx.Err() != nil {
+			break
+		}
+		if ok, fileErrs := parser.ParseText(source.Name, source.Text); !ok {
+			errs = append(errs, fileErrs...)
+		}
+	}
+	for _, filename := range opts.Filenames {
+		if ctx.Err() != nil {
+			break
+		}
+		if ok, fileErrs := parser.ParseFile(filename); !ok {
+			errs = append(errs, fileErrs...)
+		}
+	}
+	parseTime := time.Since(start)
+	parser.log().Info("parsed all files", "files", len(parser.parsed), "duration", parseTime)
+	if opts.Timings != nil {
+		opts.Timings.Read = parser.readTime
+		opts.Timings.Parse = parseTime - parser.readTime
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, Diagnostics{err}
+	}
+	start = time.Now()
+	if len(errs) == 0 {
+		parser.sortDeclarations()
+		errs = parser.CheckDuplicates()
+	}
+	if len(errs) == 0 {
+		errs = parser.ResolveConstants()
+	}
+	if len(errs) == 0 {
+		errs = parser.Resolve()
+	}
+	if len(errs) == 0 {
+		errs = parser.CheckConditions()
+	}
+	if len(errs) == 0 {
+		errs = parser.CheckVersions()
+	}
+	if len(errs) == 0 {
+		errs = parser.CheckCycles()
+	}
+	if len(errs) == 0 && opts.Lang == "c" {
+		errs = parser.CheckCNames()
+	}
+	if opts.Timings != nil {
+		opts.Timings.Resolve = time.Since(start)
+	}
+	if len(errs) > 0 {
+		return nil, SortErrors(errs)
+	}
+	if opts.Stats != nil {
+		*opts.Stats = parser.Stats()
+	}
+	return parser.Packages(), nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Conditions restrict messages and fields to code generated for specific
+// targets, for example debug builds. A package declares its conditions with
+// the option "conditions" and messages and fields refer to them with the
+// option or annotation "when".
+
+// Returns the condition names of a comma separated list.
+func conditionNames(value string) []string {
+	names := strings.Split(value, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+// Check that value is a comma separated list of condition names.
+func checkConditions(value string) error {
+	seen := make(map[string]bool)
+	for _, name := range conditionNames(value) {
+		if !isLittleIdentifier(name) {
+			return fmt.Errorf("invalid condition name %q, expected lower case identifier", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate condition %s", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// Check that the conditions of a "when" option or annotation are declared by
+// the package, declared is the value of its "conditions" option. A nil option
+// is valid.
+func checkWhen(declared string, when *Option) error {
+	if when == nil {
+		return nil
+	}
+	if declared == "" {
+		return errors.New("when requires the conditions to be declared (option conditions)")
+	}
+	names := conditionNames(declared)
+	for _, name := range conditionNames(when.Value) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("undeclared condition %s", name)
+		}
+	}
+	return nil
+}
+
+// Check that the conditions of messages and fields are declared by their
+// package, which may be done by any file of the package. Then check that
+// message fields whose type is a conditional message are conditional
+// themselves and only list conditions that the message also lists, otherwise
+// a field could be generated without its type. The conditions of a field
+// without a "when" annotation are those of its message. Types must be
+// resolved. The errors found are returned.
+func (p *Parser) CheckConditions() []error {
+	messages := make(map[string]*Message)
+	for _, pkg := range p.packages {
+		for _, m := range pkg.Messages {
+			messages[pkg.Name+"."+m.Name] = m
+		}
+	}
+	var errs []error
+	var declared string
+	isDeclared := func(when *Option) bool {
+		if err := checkWhen(declared, when); err != nil {
+			d := when.errorCtx.Error(err)
+			d.Semantic = true
+			errs = append(errs, d)
+			return false
+		}
+		return true
+	}
+	for _, pkg := range p.Packages() {
+		declared = p.PackageOption(pkg.Name, "conditions")
+		for _, m := range pkg.Messages {
+			if !isDeclared(findAnnotation(m.Options, "when")) {
+				continue
+			}
+			for _, f := range m.Fields {
+				if !isDeclared(findAnnotation(f.Annotations, "when")) {
+					continue
+				}
+				when := findAnnotation(f.Annotations, "when")
+				if when == nil {
+					when = findAnnotation(m.Options, "when")
+				}
+				var types []*FqTypeIdentifier
+				if f.Type.Map != nil {
+					types = append(types, f.Type.Map.Key.Type, f.Type.Map.Value.Type)
+				} else {
+					types = append(types, f.Type.Type)
+				}
+				for _, id := range types {
+					if id == nil || messages[id.String()] == nil {
+						continue
+					}
+					if err := checkFieldConditions(when, findAnnotation(messages[id.String()].Options, "when"), id); err != nil {
+						errs = append(errs, f.Pos.semanticError(f.Name, err))
+					}
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// Check that the conditions of a field, nil if unconditional, are a subset of
+// the conditions of the message type id, nil if unconditional.
+func checkFieldConditions(field, message *Option, id *FqTypeIdentifier) error {
+	if message == nil {
+		return nil
+	}
+	if field == nil {
+		return fmt.Errorf("field of conditional message type %s must be conditional (when = %q)", id, message.Value)
+	}
+	names := conditionNames(message.Value)
+	for _, name := range conditionNames(field.Value) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("condition %s is not a condition of message type %s (when = %q)", name, id, message.Value)
+		}
+	}
+	return nil
+}
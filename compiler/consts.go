@@ -0,0 +1,311 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Constants are named integers declared at package level
+// ("const MaxPlayers = 16"). Constant expressions combine numbers and
+// constants with the operators + - * / and parentheses. They are evaluated
+// as 64 bit signed integers and overflow is an error. Constants may be used
+// before they are declared, also by other files of the package, so constant
+// expressions are evaluated when all files are parsed.
+
+// Value range of constant expressions.
+var constRange = intRange(64)
+
+type constant struct {
+	expr     *constExpr
+	errorCtx ErrorCtx
+	node     *Constant // Syntax tree node, its value is set when resolved.
+	state    constState
+}
+
+// Resolution state of a constant.
+type constState int
+
+const (
+	constUnresolved constState = iota
+	constResolving             // The value is being evaluated, used to detect cycles.
+	constResolved
+	constInvalid // Evaluation failed and the error has been reported.
+)
+
+// Parsed constant expression. Numbers and constant names are leaves, the
+// operands of operators are x and y, except for unary minus which only has x.
+type constExpr struct {
+	errorCtx ErrorCtx // Number, constant name or operator.
+	value    int64    // Value of numbers.
+	x, y     *constExpr
+}
+
+// Size expression of a fixed array, evaluated when resolving constants.
+type arraySize struct {
+	expr     *constExpr
+	errorCtx ErrorCtx // First item of the expression.
+}
+
+// Returns the value of a constant and false if it is not declared. Values
+// are only known once constants are resolved.
+func (p *Parser) Constant(packageName, name string) (int64, bool) {
+	c, ok := p.constants[packageName][name]
+	if !ok {
+		return 0, false
+	}
+	return c.node.Value, true
+}
+
+// Parse a constant declaration, the "const" keyword has already been seen.
+func (p *Parser) parseConst() {
+	if !p.checkPackageDeclared() {
+		return
+	}
+	if !p.expectM(matchBigIdentifier) {
+		return
+	}
+	name := p.prev
+	if !p.expect(ItemEqual) {
+		return
+	}
+	if expr, ok := p.parseConstExpr(); ok && p.expect(ItemEol) {
+		p.addConst(name, expr)
+	}
+}
+
+// Add a constant to the current package. Constants are shared by all files of
+// a package.
+func (p *Parser) addConst(name Item, expr *constExpr) {
+	if p.constants == nil {
+		p.constants = make(map[string]map[string]*constant)
+	}
+	constants := p.constants[p.packageName]
+	if constants == nil {
+		constants = make(map[string]*constant)
+		p.constants[p.packageName] = constants
+	}
+	if prev, ok := constants[name.Value]; ok {
+		p.semanticError(name, fmt.Errorf("constant redeclared, previous declaration at %s", prev.errorCtx.Position()))
+		return
+	}
+	node := &Constant{Pos: p.pos(name), Name: name.Value}
+	constants[name.Value] = &constant{expr: expr, errorCtx: p.errorCtx(name), node: node}
+	pkg := p.pkg()
+	pkg.Constants = append(pkg.Constants, node)
+}
+
+// Parse a constant expression.
+//
+//	Expr = Term { ( "+" | "-" ) Term } .
+func (p *Parser) parseConstExpr() (*constExpr, bool) {
+	x, ok := p.parseConstTerm()
+	for ok && (p.accept(ItemPlus) || p.accept(ItemMinus)) {
+		op := p.prev
+		var y *constExpr
+		if y, ok = p.parseConstTerm(); ok {
+			x = &constExpr{errorCtx: p.errorCtx(op), x: x, y: y}
+		}
+	}
+	return x, ok
+}
+
+// Parse a term of a constant expression.
+//
+//	Term = Factor { ( "*" | "/" ) Factor } .
+func (p *Parser) parseConstTerm() (*constExpr, bool) {
+	x, ok := p.parseConstFactor()
+	for ok && (p.accept(ItemStar) || p.accept(ItemSlash)) {
+		op := p.prev
+		var y *constExpr
+		if y, ok = p.parseConstFactor(); ok {
+			x = &constExpr{errorCtx: p.errorCtx(op), x: x, y: y}
+		}
+	}
+	return x, ok
+}
+
+// Parse a factor of a constant expression. Numbers are checked to be in range
+// while the references to constants are resolved later.
+//
+//	Factor = Number | BigIdentifier | "(" Expr ")" | "-" Factor .
+func (p *Parser) parseConstFactor() (*constExpr, bool) {
+	switch {
+	case p.accept(ItemNumber):
+		var x big.Int
+		x.SetString(p.prev.Value, 10)
+		if !p.check(p.prev, func(Item) error { return checkConstRange(&x) }) {
+			return nil, false
+		}
+		return &constExpr{errorCtx: p.errorCtx(p.prev), value: x.Int64()}, true
+	case p.acceptM(matchBigIdentifier):
+		return &constExpr{errorCtx: p.errorCtx(p.prev)}, true
+	case p.accept(ItemLeftParen):
+		if !p.enterDepth() {
+			return nil, false
+		}
+		defer p.leaveDepth()
+		x, ok := p.parseConstExpr()
+		return x, ok && p.expect(ItemRightParen)
+	case p.accept(ItemMinus):
+		op := p.prev
+		if !p.enterDepth() {
+			return nil, false
+		}
+		defer p.leaveDepth()
+		x, ok := p.parseConstFactor()
+		return &constExpr{errorCtx: p.errorCtx(op), x: x}, ok
+	}
+	p.itemError(p.next, errors.New("expected constant expression"))
+	return nil, false
+}
+
+// Check the value range of constant expressions.
+func checkConstRange(x *big.Int) error {
+	if x.Cmp(constRange[0]) < 0 || x.Cmp(constRange[1]) > 0 {
+		return errors.New("constant overflow")
+	}
+	return nil
+}
+
+// Evaluate the constants and fixed array sizes of all parsed files. Constants
+// are evaluated in any order, undefined constants, constants depending on
+// themselves, overflow, division by zero and array sizes out of range are
+// reported. The errors found are returned.
+func (p *Parser) ResolveConstants() []error {
+	var errs []error
+	for _, pkg := range p.Packages() {
+		r := constResolver{constants: p.constants[pkg.Name], maxArraySize: p.MaxArraySize}
+		if r.maxArraySize == 0 || pkg.Name == stdPackage {
+			r.maxArraySize = DefaultMaxArraySize
+		}
+		names := make([]string, 0, len(r.constants))
+		for name := range r.constants {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			r.resolve(r.constants[name])
+		}
+		for _, m := range pkg.Messages {
+			for _, f := range m.Fields {
+				r.resolveArraySize(&f.Type)
+				if f.Type.Map != nil {
+					r.resolveArraySize(&f.Type.Map.Value)
+				}
+			}
+		}
+		for _, t := range pkg.Types {
+			r.resolveArraySize(&t.Type)
+		}
+		errs = append(errs, r.errs...)
+	}
+	return errs
+}
+
+// Resolves the constants and array sizes of a package.
+type constResolver struct {
+	constants    map[string]*constant // Constants of the package by name.
+	maxArraySize uint64
+	errs         []error
+}
+
+func (r *constResolver) error(ctx ErrorCtx, details error) {
+	d := ctx.Error(details)
+	d.Semantic = true
+	r.errs = append(r.errs, d)
+}
+
+// Evaluate a constant unless already done. Returns false if it's invalid.
+func (r *constResolver) resolve(c *constant) bool {
+	switch c.state {
+	case constResolved:
+		return true
+	case constInvalid:
+		return false
+	case constResolving:
+		r.error(c.errorCtx, fmt.Errorf("constant %s depends on itself", c.node.Name))
+		c.state = constInvalid
+		return false
+	}
+	c.state = constResolving
+	var x big.Int
+	if !r.eval(c.expr, &x) {
+		c.state = constInvalid
+		return false
+	}
+	c.node.Value, c.state = x.Int64(), constResolved
+	return true
+}
+
+// Evaluate a constant expression and store its value in x. Returns false if
+// it's invalid.
+func (r *constResolver) eval(e *constExpr, x *big.Int) bool {
+	op := e.errorCtx.item
+	switch {
+	case op.Kind == ItemNumber:
+		x.SetInt64(e.value)
+		return true
+	case op.Kind == ItemIdentifier:
+		c := r.constants[op.Value]
+		if c == nil {
+			r.error(e.errorCtx, errors.New("undefined constant"))
+			return false
+		}
+		if !r.resolve(c) {
+			return false
+		}
+		x.SetInt64(c.node.Value)
+		return true
+	case !r.eval(e.x, x):
+		return false
+	case e.y == nil:
+		x.Neg(x)
+	default:
+		var y big.Int
+		if !r.eval(e.y, &y) {
+			return false
+		}
+		switch op.Kind {
+		case ItemPlus:
+			x.Add(x, &y)
+		case ItemMinus:
+			x.Sub(x, &y)
+		case ItemStar:
+			x.Mul(x, &y)
+		default:
+			if y.Sign() == 0 {
+				r.error(e.errorCtx, errors.New("division by zero"))
+				return false
+			}
+			x.Quo(x, &y)
+		}
+	}
+	if err := checkConstRange(x); err != nil {
+		r.error(e.errorCtx, err)
+		return false
+	}
+	return true
+}
+
+// Evaluate the size of a fixed array.
+func (r *constResolver) resolveArraySize(ft *FieldType) {
+	if ft.size == nil {
+		return
+	}
+	var size big.Int
+	if r.eval(ft.size.expr, &size) {
+		if err := checkArraySize(&size, r.maxArraySize); err != nil {
+			r.error(ft.size.errorCtx, err)
+		} else {
+			ft.ArraySize = size.Uint64()
+		}
+	}
+	ft.size = nil
+}
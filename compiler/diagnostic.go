@@ -0,0 +1,62 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diagnostic is an error located in a source file.
+type Diagnostic struct {
+	File   string // Name of the source file.
+	Line   int    // Line number in the source file.
+	Column int    // Column number in the source file.
+	Msg    string // Description of the error.
+
+	// The error is semantic, the source is syntactically valid.
+	Semantic bool
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s:%d:%d: error: %s", d.File, d.Line, d.Column, d.Msg)
+}
+
+// Sort errors by file, line and column and remove duplicates. Errors without
+// a source location are placed first in their original order.
+func SortErrors(errs []error) []error {
+	sorted := make([]error, len(errs))
+	copy(sorted, errs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return diagnosticLess(sorted[i], sorted[j])
+	})
+
+	var unique []error
+	seen := make(map[string]bool)
+	for _, err := range sorted {
+		if s := err.Error(); !seen[s] {
+			seen[s] = true
+			unique = append(unique, err)
+		}
+	}
+	return unique
+}
+
+func diagnosticLess(a, b error) bool {
+	da, aok := a.(*Diagnostic)
+	db, bok := b.(*Diagnostic)
+	switch {
+	case !aok || !bok:
+		return !aok && bok
+	case da.File != db.File:
+		return da.File < db.File
+	case da.Line != db.Line:
+		return da.Line < db.Line
+	case da.Column != db.Column:
+		return da.Column < db.Column
+	}
+	return da.Msg < db.Msg
+}
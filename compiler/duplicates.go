@@ -0,0 +1,106 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Check that type names are unique within each package, including types
+// declared by different files, the names code generators give anonymous enums
+// and constant names, and that field tags and names, choice tags and enum
+// value names are unique within their declaration. Every duplicate is
+// reported at its position together with the position of the first use. The
+// errors found are returned.
+func (p *Parser) CheckDuplicates() []error {
+	var errs []error
+	seen := make(map[string]*typeDecl)
+	for i := range p.types {
+		t := &p.types[i]
+		if prev, ok := seen[t.fqName()]; ok {
+			d := t.errorCtx.Error(fmt.Errorf("type %s redeclared, previous declaration at %s", t.name, prev.errorCtx.Position()))
+			d.Semantic = true
+			errs = append(errs, d)
+			continue
+		}
+		seen[t.fqName()] = t
+	}
+	for _, pkg := range p.Packages() {
+		for _, c := range pkg.Constants {
+			if prev, ok := seen[pkg.Name+"."+c.Name]; ok {
+				errs = append(errs, c.Pos.semanticError(c.Name, fmt.Errorf("constant %s collides with type declared at %s", c.Name, prev.errorCtx.Position())))
+			}
+		}
+		// Names of anonymous enums by fully qualified name.
+		inlineEnums := make(duplicates)
+		for _, m := range pkg.Messages {
+			for _, f := range m.Fields {
+				if f.Type.Enum == nil {
+					continue
+				}
+				name := inlineEnumName(m, f)
+				if prev, ok := seen[pkg.Name+"."+name]; ok {
+					errs = append(errs, f.Pos.semanticError(f.Name, fmt.Errorf("anonymous enum name %s collides with type declared at %s", name, prev.errorCtx.Position())))
+					continue
+				}
+				errs = inlineEnums.add(errs, name, f.Pos, f.Name, "anonymous enum name %s also used at %s")
+			}
+		}
+		for _, m := range pkg.Messages {
+			tags := make(duplicates)
+			names := make(duplicates)
+			for _, f := range m.Fields {
+				errs = tags.add(errs, strconv.FormatUint(f.Tag, 10), f.Pos, f.Name, "tag %s also used at %s")
+				errs = names.add(errs, f.Name, f.Pos, f.Name, "field name %s also used at %s")
+				if f.Type.Enum != nil {
+					errs = checkEnumDuplicates(errs, f.Type.Enum)
+				}
+			}
+		}
+		for _, e := range pkg.Enums {
+			errs = checkEnumDuplicates(errs, e)
+		}
+		for _, c := range pkg.Choices {
+			tags := make(duplicates)
+			for _, a := range c.Alternatives {
+				errs = tags.add(errs, strconv.FormatUint(a.Tag, 10), a.Pos, a.Name, "tag %s also used at %s")
+			}
+		}
+	}
+	return errs
+}
+
+// Returns the name code generators give the anonymous enum of a message
+// field, the message name followed by the capitalized field name.
+func inlineEnumName(m *Message, f *Field) string {
+	return m.Name + strings.ToUpper(f.Name[:1]) + f.Name[1:]
+}
+
+// Check that the value names of an enum are unique. Duplicate numbers are
+// checked while parsing since they are allowed by the allowAlias option.
+func checkEnumDuplicates(errs []error, e *Enum) []error {
+	names := make(duplicates)
+	for _, v := range e.Values {
+		errs = names.add(errs, v.Name, v.Pos, v.Name, "value name %s also used at %s")
+	}
+	return errs
+}
+
+// Positions of the first use of keys (tags or names) in a declaration.
+type duplicates map[string]Pos
+
+// Add a key used at pos by the named member. If the key is already used an
+// error formatted from the key and the position of its first use is appended
+// to errs. The possibly extended errs is returned.
+func (dups duplicates) add(errs []error, key string, pos Pos, member, format string) []error {
+	if prev, ok := dups[key]; ok {
+		return append(errs, pos.semanticError(member, fmt.Errorf(format, key, prev)))
+	}
+	dups[key] = pos
+	return errs
+}
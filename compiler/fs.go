@@ -0,0 +1,90 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteFS is a file system generated files are written to. Speak files are
+// read through an fs.FS, see Options.FS.
+type WriteFS interface {
+	// Write a file, name is an unrooted slash separated path as used by
+	// io/fs. Directories are created as needed.
+	WriteFile(name string, data []byte) error
+}
+
+// Returns a file system writing below a directory of the operating system.
+// Files are replaced atomically so readers never see partial contents.
+func DirFS(dir string) WriteFS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+func (dir dirFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	filename := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return err
+	}
+	tmp, err := createTemp(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Create a new temporary file in dir. Unlike os.CreateTemp the file gets the
+// mode 0666 less the umask, the mode of files created by os.Create, since it
+// replaces the file to write.
+func createTemp(dir string) (*os.File, error) {
+	for {
+		name := filepath.Join(dir, ".tmp-"+strconv.FormatUint(rand.Uint64(), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// MapFS is an in-memory file system of file contents by name, used to
+// compile without touching the disk, e.g. in tests or web browsers.
+type MapFS map[string][]byte
+
+func (m MapFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	m[name] = bytes.Clone(data)
+	return nil
+}
+
+// Write the files to a file system.
+func (files Files) Write(fsys WriteFS) error {
+	for _, file := range files {
+		if err := fsys.WriteFile(file.Name, file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Files written by DirFS get the same mode as files created by os.Create.
+func TestDirFSFileMode(t *testing.T) {
+	dir := t.TempDir()
+	if err := DirFS(dir).WriteFile("a/b.go", []byte("package b\n")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "c.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	written, err := os.Stat(filepath.Join(dir, "a", "b.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := os.Stat(filepath.Join(dir, "c.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.Mode() != created.Mode() {
+		t.Fatalf("mode %v, expected %v", written.Mode(), created.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "a")); len(entries) != 1 {
+		t.Fatalf("temporary files left: %v", entries)
+	}
+}
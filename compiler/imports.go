@@ -0,0 +1,114 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Parse an import declaration, the "import" keyword has already been seen.
+// The imported file is parsed after the current file.
+func (p *Parser) parseImport() {
+	if !p.checkPackageDeclared() {
+		return
+	}
+	if !p.expect(ItemStringLiteral) {
+		return
+	}
+	item := p.prev
+	name, _ := strconv.Unquote(item.Value)
+	if !p.expect(ItemEol) {
+		return
+	}
+	if filename, err := p.findImport(name); err != nil {
+		p.semanticError(item, err)
+	} else {
+		p.imports = append(p.imports, filename)
+	}
+}
+
+// Returns the file an import refers to. The directory of the importing file
+// is searched first, then the include paths in order.
+func (p *Parser) findImport(name string) (string, error) {
+	join, dir := filepath.Join, filepath.Dir
+	if p.FS != nil {
+		join, dir = path.Join, path.Dir
+	}
+	if p.FS == nil && filepath.IsAbs(name) {
+		if _, err := os.Stat(name); err != nil {
+			return "", errors.New("imported file not found")
+		}
+		return name, nil
+	}
+	dirs := append([]string{dir(p.lexer.Name)}, p.IncludePaths...)
+	for _, d := range dirs {
+		filename := join(d, name)
+		var err error
+		if p.FS != nil {
+			_, err = fs.Stat(p.FS, filename)
+		} else {
+			_, err = os.Stat(filename)
+		}
+		if err == nil {
+			return filename, nil
+		}
+	}
+	return "", fmt.Errorf("imported file not found in %s", strings.Join(dirs, ", "))
+}
+
+// Parse the files imported by the file parsed last. The result of the file
+// parsed last is returned together with the errors found in the imported
+// files. The package of the file parsed last is kept as the current package.
+func (p *Parser) parseImports() (bool, []error) {
+	ok, errs := p.ok(), p.errors
+	packageName := p.packageName
+	defer func() { p.packageName = packageName }()
+	for _, filename := range p.imports {
+		if p.ctx != nil && p.ctx.Err() != nil {
+			break
+		}
+		p.log().Debug("importing", "file", filename)
+		if importOk, importErrs := p.ParseFile(filename); !importOk {
+			ok = false
+			errs = append(errs, importErrs...)
+		}
+	}
+	return ok, errs
+}
+
+// Record that a file has been parsed, its package is recorded once declared.
+func (p *Parser) markParsed(filename string) {
+	if p.parsed == nil {
+		p.parsed = make(map[string]string)
+	}
+	p.parsed[p.cleanPath(filename)] = ""
+}
+
+// Reports whether a file has been parsed.
+func (p *Parser) isParsed(filename string) bool {
+	_, ok := p.parsed[p.cleanPath(filename)]
+	return ok
+}
+
+// Returns the package declared by a parsed file, also if it was parsed as an
+// import, or "" if the file is not parsed or does not declare its package.
+func (p *Parser) FilePackageName(filename string) string {
+	return p.parsed[p.cleanPath(filename)]
+}
+
+func (p *Parser) cleanPath(filename string) string {
+	if p.FS != nil {
+		return path.Clean(filename)
+	}
+	return filepath.Clean(filename)
+}
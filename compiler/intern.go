@@ -0,0 +1,33 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"strings"
+)
+
+// StringTable interns strings so that equal strings share the same memory.
+// Interned identifiers don't keep the source text they were scanned from
+// alive and comparisons between them are fast since equal strings have
+// identical data pointers. A table is not safe for concurrent use.
+type StringTable struct {
+	strings map[string]string
+}
+
+// Creates a new empty string table.
+func NewStringTable() *StringTable {
+	return &StringTable{strings: make(map[string]string)}
+}
+
+// Returns the interned copy of s.
+func (t *StringTable) Intern(s string) string {
+	if interned, ok := t.strings[s]; ok {
+		return interned
+	}
+	s = strings.Clone(s)
+	t.strings[s] = s
+	return s
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+)
+
+// Keywords of the C language (C11), including the macros defined by standard
+// headers that the generated code depends on.
+var cKeywords = keywordSet(
+	"auto", "bool", "break", "case", "char", "const", "continue", "default",
+	"do", "double", "else", "enum", "extern", "false", "float", "for", "goto",
+	"if", "inline", "int", "long", "register", "restrict", "return", "short",
+	"signed", "sizeof", "static", "struct", "switch", "true", "typedef",
+	"union", "unsigned", "void", "volatile", "while",
+	"_Alignas", "_Alignof", "_Atomic", "_Bool", "_Complex", "_Generic",
+	"_Imaginary", "_Noreturn", "_Static_assert", "_Thread_local",
+)
+
+// Keywords of the Go language.
+var goKeywords = keywordSet(
+	"break", "case", "chan", "const", "continue", "default", "defer", "else",
+	"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+	"map", "package", "range", "return", "select", "struct", "switch", "type",
+	"var",
+)
+
+func keywordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// Check that a message field or choice alternative name does not collide
+// with a keyword of the target language once converted to the field case.
+func (p *Parser) checkFieldName(item Item) error {
+	converted := p.Naming.Field.Convert(item.Value)
+	if p.Lang == "c" && cKeywords[converted] || p.Lang == "go" && goKeywords[converted] {
+		if converted != item.Value {
+			return fmt.Errorf("field name is a keyword in %s when converted to %s case ('%s')",
+				langName(p.Lang), p.Naming.Field, converted)
+		}
+		return fmt.Errorf("field name is a keyword in %s", langName(p.Lang))
+	}
+	return nil
+}
+
+// Check that a package name does not collide with a keyword of the target
+// language. C package names are only used as prefixes and can not collide.
+func (p *Parser) checkPackageName(item Item) error {
+	if p.Lang == "go" && goKeywords[item.Value] {
+		return fmt.Errorf("package name is a keyword in %s", langName(p.Lang))
+	}
+	return nil
+}
+
+// Human readable name of a target language.
+func langName(lang string) string {
+	switch lang {
+	case "c":
+		return "C"
+	case "go":
+		return "Go"
+	}
+	return lang
+}
@@ -0,0 +1,602 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Copyright 2013 Johan Bolmsjö
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE.go-derived file.
+
+package compiler
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Identifies the type of item.
+type ItemKind int
+
+// Types of item.
+const (
+	ItemError ItemKind = iota
+	ItemIdentifier
+	ItemNumber
+	ItemStringLiteral
+	ItemEol
+	ItemEof
+	ItemLeftBracket
+	ItemRightBracket
+	ItemLeftAngle
+	ItemRightAngle
+	ItemDot
+	ItemColon
+	ItemComma
+	ItemEqual
+	ItemMinus
+	ItemPlus
+	ItemStar
+	ItemSlash
+	ItemLeftParen
+	ItemRightParen
+	ItemChoice
+	ItemConst
+	ItemEnd
+	ItemEnum
+	ItemExtensions
+	ItemImport
+	ItemMap
+	ItemMessage
+	ItemOption
+	ItemOptional
+	ItemPackage
+	ItemTo
+	ItemType
+	ItemBasicTypeBegin
+	ItemBool
+	ItemByte
+	ItemInt8
+	ItemInt16
+	ItemInt32
+	ItemInt64
+	ItemInt128
+	ItemUint8
+	ItemUint16
+	ItemUint32
+	ItemUint64
+	ItemUint128
+	ItemFloat32
+	ItemFloat64
+	ItemString
+	ItemFixed
+	ItemUfixed
+	ItemAny
+	ItemBasicTypeEnd
+)
+
+var itemKindToStr = map[ItemKind]string{
+	ItemError:         "<error>",
+	ItemIdentifier:    "<identifier>",
+	ItemNumber:        "<number>",
+	ItemStringLiteral: "<string literal>",
+	ItemEol:           "<eol>",
+	ItemEof:           "<eof>",
+	ItemLeftBracket:   "[",
+	ItemRightBracket:  "]",
+	ItemLeftAngle:     "<",
+	ItemRightAngle:    ">",
+	ItemDot:           ".",
+	ItemColon:         ":",
+	ItemComma:         ",",
+	ItemEqual:         "=",
+	ItemMinus:         "-",
+	ItemPlus:          "+",
+	ItemStar:          "*",
+	ItemSlash:         "/",
+	ItemLeftParen:     "(",
+	ItemRightParen:    ")",
+	ItemChoice:        "choice",
+	ItemConst:         "const",
+	ItemEnd:           "end",
+	ItemEnum:          "enum",
+	ItemExtensions:    "extensions",
+	ItemImport:        "import",
+	ItemMap:           "map",
+	ItemMessage:       "message",
+	ItemOption:        "option",
+	ItemOptional:      "optional",
+	ItemPackage:       "package",
+	ItemTo:            "to",
+	ItemType:          "type",
+	ItemBool:          "bool",
+	ItemByte:          "byte",
+	ItemInt8:          "int8",
+	ItemInt16:         "int16",
+	ItemInt32:         "int32",
+	ItemInt64:         "int64",
+	ItemInt128:        "int128",
+	ItemUint8:         "uint8",
+	ItemUint16:        "uint16",
+	ItemUint32:        "uint32",
+	ItemUint64:        "uint64",
+	ItemUint128:       "uint128",
+	ItemFloat32:       "float32",
+	ItemFloat64:       "float64",
+	ItemString:        "string",
+	ItemFixed:         "fixed",
+	ItemUfixed:        "ufixed",
+	ItemAny:           "any",
+}
+
+var strToItemKind = map[string]ItemKind{
+	"choice":     ItemChoice,
+	"const":      ItemConst,
+	"end":        ItemEnd,
+	"enum":       ItemEnum,
+	"extensions": ItemExtensions,
+	"import":     ItemImport,
+	"map":        ItemMap,
+	"message":    ItemMessage,
+	"option":     ItemOption,
+	"optional":   ItemOptional,
+	"package":    ItemPackage,
+	"to":         ItemTo,
+	"type":       ItemType,
+	"bool":       ItemBool,
+	"byte":       ItemByte,
+	"int8":       ItemInt8,
+	"int16":      ItemInt16,
+	"int32":      ItemInt32,
+	"int64":      ItemInt64,
+	"int128":     ItemInt128,
+	"uint8":      ItemUint8,
+	"uint16":     ItemUint16,
+	"uint32":     ItemUint32,
+	"uint64":     ItemUint64,
+	"uint128":    ItemUint128,
+	"float32":    ItemFloat32,
+	"float64":    ItemFloat64,
+	"string":     ItemString,
+	"fixed":      ItemFixed,
+	"ufixed":     ItemUfixed,
+	"any":        ItemAny,
+}
+
+func (kind ItemKind) String() string {
+	if s, ok := itemKindToStr[kind]; ok {
+		return s
+	}
+	return fmt.Sprintf("%d", int(kind))
+}
+
+// Check if an item kind is a basic type.
+func (kind ItemKind) isBasicType() bool {
+	if kind > ItemBasicTypeBegin && kind < ItemBasicTypeEnd {
+		return true
+	}
+	return false
+}
+
+// item represents a token or text string returned from the scanner.
+type Item struct {
+	Kind  ItemKind // The type of this item.
+	Value string   // The value of this item.
+	Pos   int      // The starting position, in bytes, of this item in the input string.
+}
+
+// Check if an item is a keyword.
+func (item Item) isKeyword() bool {
+	kind, ok := strToItemKind[item.Value]
+	return ok && kind == item.Kind
+}
+
+func (item Item) String() string {
+	if item.Kind == ItemError || item.Kind == ItemIdentifier || item.Kind == ItemNumber ||
+		item.Kind == ItemStringLiteral {
+		return item.Value
+	}
+	return fmt.Sprintf("%v", item.Kind)
+}
+
+const eof = -1
+
+type stateFn func(*Lexer) stateFn
+
+type Lexer struct {
+	Name  string    // Name of lexer for error reporting.
+	input string    // The string being scanned.
+	state stateFn   // The next lexing function to enter.
+	pos   int       // Current position in input.
+	start int       // Start position of item in input.
+	width int       // Width of last rune read from input.
+	items chan Item // Scanned items.
+	done  chan bool // Closed when the parser stops reading items.
+
+	strings *StringTable // Table interning identifiers read by NextItem, may be nil.
+
+	// Number of lines before input offset lineOffset, kept since positions
+	// are mostly requested in increasing order.
+	lineOffset, lineCount int
+}
+
+// Returns the next rune in the input.
+func (l *Lexer) next() rune {
+	if int(l.pos) >= len(l.input) {
+		l.width = 0
+		return eof
+	}
+	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
+	l.width = w
+	l.pos += w
+	return r
+}
+
+// Returns but does not consume the next rune in the input.
+func (l *Lexer) peek() rune {
+	r := l.next()
+	l.backup()
+	return r
+}
+
+// Steps back one rune. Can only be called once per call of next.
+func (l *Lexer) backup() {
+	l.pos -= l.width
+}
+
+// Passes a item back to the client.
+func (l *Lexer) emit(kind ItemKind) {
+	l.send(Item{kind, l.acceptStr(), l.start})
+	l.start = l.pos
+}
+
+// Sends an item to the parser. The lexer goroutine exits if the lexer has been
+// closed.
+func (l *Lexer) send(item Item) {
+	select {
+	case l.items <- item:
+	case <-l.done:
+		runtime.Goexit()
+	}
+}
+
+// Skips over the pending input before this point.
+func (l *Lexer) ignore() {
+	l.start = l.pos
+}
+
+// Consumes the next rune if it's from the valid set.
+func (l *Lexer) accept(valid string) bool {
+	if strings.IndexRune(valid, l.next()) >= 0 {
+		return true
+	}
+	l.backup()
+	return false
+}
+
+// Consumes a run of runes from the valid set.
+func (l *Lexer) acceptRun(valid string) {
+	for strings.IndexRune(valid, l.next()) >= 0 {
+	}
+	l.backup()
+}
+
+// Returns the currently accepted string.
+func (l *Lexer) acceptStr() string {
+	return l.input[l.start:l.pos]
+}
+
+// Returns the current accept length.
+func (l *Lexer) acceptLen() int {
+	return l.pos - l.start
+}
+
+// Count line endings in s. Line endings are LF, CR LF or a lone CR.
+func countLines(s string) int {
+	return strings.Count(s, "\n") + strings.Count(s, "\r") - strings.Count(s, "\r\n")
+}
+
+// Returns the number of lines in the input before offset pos. Lines are
+// counted from the previous offset if possible.
+func (l *Lexer) linesBefore(pos int) int {
+	if pos < l.lineOffset || l.lineOffset > 0 && l.input[l.lineOffset-1] == '\r' {
+		l.lineOffset, l.lineCount = 0, 0
+	}
+	l.lineCount += countLines(l.input[l.lineOffset:pos])
+	l.lineOffset = pos
+	return l.lineCount
+}
+
+// Report the line number that item was from.
+func (l *Lexer) LineNumber(item Item) int {
+	if item.Kind == ItemEof || item.Pos >= len(l.input) {
+		return 1 + countLines(l.input)
+	} else {
+		line := 1 + l.linesBefore(item.Pos)
+		if isEol(rune(l.input[item.Pos])) {
+			line++
+		}
+		return line
+	}
+}
+
+// Report the column number that item was from.
+func (l *Lexer) ColumnNumber(item Item) int {
+	column := -1
+	pos := min(item.Pos, len(l.input))
+	if item.Kind == ItemEof || pos == len(l.input) {
+		if pos > 0 {
+			pos--
+			column++
+		} else {
+			return 0
+		}
+	}
+	for i := pos; i >= 0; i-- {
+		c := rune(l.input[i])
+		if isEol(c) {
+			break
+		}
+		if utf8.RuneStart(byte(c)) {
+			/* utf8 start character */
+			column++
+		}
+	}
+	return column
+}
+
+// Returns an error token and terminates the scan by passing
+// back a nil pointer that will be the next state, terminating l.nextItem.
+func (l *Lexer) errorf(format string, args ...interface{}) stateFn {
+	l.send(Item{ItemError, fmt.Sprintf(format, args...), l.start})
+	return nil
+}
+
+// nextItem returns the next item from the input. Identifiers are interned
+// here rather than by the lexer goroutine since the string table is shared
+// with the parser and with lexers of other files.
+func (l *Lexer) NextItem() Item {
+	item := <-l.items
+	if item.Kind == ItemIdentifier && l.strings != nil {
+		item.Value = l.strings.Intern(item.Value)
+	}
+	return item
+}
+
+// Stops the lexer, no more items may be read. Must be called when items are
+// not read up to the end of the input.
+func (l *Lexer) Close() {
+	close(l.done)
+}
+
+// Byte order mark, skipped if present at the start of the input.
+const bom = "\uFEFF"
+
+// Creates a new scanner for the input string. Identifiers are interned in
+// the string table unless it's nil.
+func NewLexer(name, input string, table *StringTable) *Lexer {
+	input = strings.TrimPrefix(input, bom)
+	l := &Lexer{
+		Name:    name,
+		input:   input,
+		items:   make(chan Item),
+		done:    make(chan bool),
+		strings: table,
+	}
+	go l.run()
+	return l
+}
+
+// Runs the state machine for the lexer.
+func (l *Lexer) run() {
+	for l.state = lexRoot; l.state != nil; {
+		l.state = l.state(l)
+	}
+}
+
+//
+// State functions
+//
+
+// Top level lexer.
+func lexRoot(l *Lexer) stateFn {
+	for {
+		switch r := l.next(); {
+		case r == eof:
+			l.emit(ItemEof)
+			return nil
+		case r == '/' && l.peek() == '/':
+			l.next()
+			return lexComment
+		case isEol(r):
+			return lexEol
+		case isSpace(r):
+			return lexSpace
+		case r == '[':
+			l.emit(ItemLeftBracket)
+		case r == ']':
+			l.emit(ItemRightBracket)
+		case r == '<':
+			l.emit(ItemLeftAngle)
+		case r == '>':
+			l.emit(ItemRightAngle)
+		case r == '.':
+			l.emit(ItemDot)
+		case r == ':':
+			l.emit(ItemColon)
+		case r == ',':
+			l.emit(ItemComma)
+		case r == '=':
+			l.emit(ItemEqual)
+		case r == '-':
+			l.emit(ItemMinus)
+		case r == '+':
+			l.emit(ItemPlus)
+		case r == '*':
+			l.emit(ItemStar)
+		case r == '/':
+			l.emit(ItemSlash)
+		case r == '(':
+			l.emit(ItemLeftParen)
+		case r == ')':
+			l.emit(ItemRightParen)
+		case r == '"':
+			return lexStringLiteral
+		case isLetter(r):
+			return lexIdentifier
+		case isDigit(r):
+			return lexNumber
+		case l.invalidRune(r):
+			return l.errorInvalidRune()
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return l.errorf("non-ASCII character %#U, identifiers may only contain ASCII letters and digits", r)
+		default:
+			return l.errorf("unrecognized character: %#U", r)
+		}
+	}
+}
+
+// Scans a run of space characters.
+// One space has already been seen.
+func lexSpace(l *Lexer) stateFn {
+	for isSpace(l.peek()) {
+		l.next()
+	}
+	l.ignore()
+	return lexRoot
+}
+
+// Scans a run of EOL characters.
+// One EOL character has already been seen.
+func lexEol(l *Lexer) stateFn {
+	for isEol(l.peek()) {
+		l.next()
+	}
+	l.emit(ItemEol)
+	return lexRoot
+}
+
+// Scans characters until EOL or EOF.
+// The comment marker '//' has already been seen.
+func lexComment(l *Lexer) stateFn {
+	for r := l.peek(); !isEol(r) && r != eof; r = l.peek() {
+		if l.next(); l.invalidRune(r) {
+			return l.errorInvalidRune()
+		}
+	}
+	l.ignore()
+	return lexRoot
+}
+
+// Scans identifiers and keywords.
+func lexIdentifier(l *Lexer) stateFn {
+Loop:
+	for {
+		switch r := l.next(); {
+		case isAlphaNumeric(r):
+			// absorb.
+		default:
+			// Check if the scanned token is an identifier or some other item kind.
+			l.backup()
+			itemKind := strToItemKind[l.acceptStr()]
+			switch {
+			case itemKind != 0:
+				l.emit(itemKind)
+			default:
+				l.emit(ItemIdentifier)
+			}
+			break Loop
+		}
+	}
+	return lexRoot
+}
+
+// Scans a double quoted string literal using Go escape sequences.
+// The opening quote has already been seen.
+func lexStringLiteral(l *Lexer) stateFn {
+	for {
+		r := l.next()
+		if r == '\\' {
+			// The escape sequence is validated when the literal is complete.
+			if r = l.next(); r != eof && !isEol(r) {
+				continue
+			}
+		}
+		switch {
+		case r == eof || isEol(r):
+			return l.errorf("unterminated string literal")
+		case l.invalidRune(r):
+			return l.errorInvalidRune()
+		case r == '"':
+			if _, err := strconv.Unquote(l.acceptStr()); err != nil {
+				return l.errorf("bad string literal syntax: %s", l.acceptStr())
+			}
+			l.emit(ItemStringLiteral)
+			return lexRoot
+		}
+	}
+}
+
+// Scans a positive decimal number.
+func lexNumber(l *Lexer) stateFn {
+	if !l.scanNumber() {
+		return l.errorf("bad number syntax: %q", l.acceptStr())
+	}
+	l.emit(ItemNumber)
+	return lexRoot
+}
+
+func (l *Lexer) scanNumber() bool {
+	l.acceptRun("0123456789")
+
+	// The first digit must not be '0' if there are more than one digits.
+	if l.acceptLen() > 1 && l.input[l.start] == '0' {
+		return false
+	}
+
+	// Do some basic validation of the character that follows the last digit.
+	r := l.peek()
+	if isLetter(r) {
+		l.next()
+		return false
+	}
+	return true
+}
+
+// Reports whether r, the last rune read from the input, is an invalid UTF-8
+// encoding.
+func (l *Lexer) invalidRune(r rune) bool {
+	return r == utf8.RuneError && l.width == 1
+}
+
+// Returns an error token for an invalid UTF-8 encoding of the last rune read
+// from the input.
+func (l *Lexer) errorInvalidRune() stateFn {
+	l.start = l.pos - l.width
+	return l.errorf("invalid UTF-8 encoding: %#x", l.input[l.start])
+}
+
+// Reports whether r is a space character.
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// Reports whether r is an EOL character.
+func isEol(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// Reports whether r is a digit.
+func isDigit(r rune) bool {
+	return ('0' <= r && r <= '9')
+}
+
+// Reports whether r is a letter.
+func isLetter(r rune) bool {
+	return ('A' <= r && r <= 'Z') || ('a' <= r && r <= 'z')
+}
+
+// Reports whether r is an alphabetic, digit.
+func isAlphaNumeric(r rune) bool {
+	return isLetter(r) || isDigit(r)
+}
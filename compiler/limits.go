@@ -0,0 +1,87 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+)
+
+// Limits protects the parser against pathological input.
+// Zero valued fields are replaced by the corresponding DefaultLimits value.
+type Limits struct {
+	FileSize         int // Largest source file size in bytes.
+	Tokens           int // Largest number of tokens in a source file.
+	Depth            int // Deepest nesting of definitions.
+	IdentifierLength int // Longest identifier in bytes.
+}
+
+// FileSizeError is returned for source files larger than Limits.FileSize.
+type FileSizeError struct {
+	File  string // Name of the file.
+	Limit int    // Largest allowed size in bytes.
+}
+
+func (e *FileSizeError) Error() string {
+	return fmt.Sprintf("%s: error: file too large (limit %d bytes)", e.File, e.Limit)
+}
+
+// Limits used by the parser unless configured otherwise.
+var DefaultLimits = Limits{
+	FileSize:         16 << 20,
+	Tokens:           1 << 22,
+	Depth:            32,
+	IdentifierLength: 255,
+}
+
+// Returns the limits with zero valued fields replaced by defaults.
+func (l Limits) withDefaults() Limits {
+	if l.FileSize == 0 {
+		l.FileSize = DefaultLimits.FileSize
+	}
+	if l.Tokens == 0 {
+		l.Tokens = DefaultLimits.Tokens
+	}
+	if l.Depth == 0 {
+		l.Depth = DefaultLimits.Depth
+	}
+	if l.IdentifierLength == 0 {
+		l.IdentifierLength = DefaultLimits.IdentifierLength
+	}
+	return l
+}
+
+// Number of tokens parsed between checks for cancellation.
+const cancelInterval = 1024
+
+// Check the next item against the token count and identifier length limits.
+// Parsing is also stopped if the context of the parser is done.
+func (p *Parser) checkItemLimits() {
+	p.tokens++
+	switch {
+	case !p.ok():
+		// Parsing is about to stop, don't report more errors.
+	case p.tokens > p.limits.Tokens:
+		p.itemError(p.next, fmt.Errorf("too many tokens (limit %d)", p.limits.Tokens))
+	case p.next.Kind == ItemIdentifier && len(p.next.Value) > p.limits.IdentifierLength:
+		p.itemError(p.next, fmt.Errorf("identifier too long (limit %d)", p.limits.IdentifierLength))
+	case p.ctx != nil && p.tokens%cancelInterval == 0 && p.ctx.Err() != nil:
+		p.errors = append(p.errors, p.ctx.Err())
+	}
+}
+
+// Enter a nested definition, the accepted item is the one opening it.
+func (p *Parser) enterDepth() bool {
+	if p.depth++; p.depth > p.limits.Depth {
+		p.itemError(p.prev, fmt.Errorf("definitions nested too deep (limit %d)", p.limits.Depth))
+		return false
+	}
+	return true
+}
+
+// Leave a nested definition.
+func (p *Parser) leaveDepth() {
+	p.depth--
+}
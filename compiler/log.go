@@ -0,0 +1,20 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import "log/slog"
+
+// Logger discarding all records, used when no logger is set.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Returns the logger of the parser, progress is logged at level info and
+// details useful when debugging the compiler at level debug.
+func (p *Parser) log() *slog.Logger {
+	if p.Logger == nil {
+		return discardLogger
+	}
+	return p.Logger
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Case identifies how a speak identifier is converted to a target language
+// identifier.
+type Case int
+
+// Identifier cases.
+const (
+	CaseAsIs       Case = iota // Keep the identifier as is.
+	CaseCamel                  // fooBar, acronyms after the first word are kept.
+	CasePascal                 // FooBar, acronyms are kept.
+	CaseSnake                  // foo_bar
+	CaseUpperSnake             // FOO_BAR
+)
+
+var caseToStr = map[Case]string{
+	CaseAsIs:       "as-is",
+	CaseCamel:      "camel",
+	CasePascal:     "pascal",
+	CaseSnake:      "snake",
+	CaseUpperSnake: "upper-snake",
+}
+
+func (c Case) String() string {
+	if s, ok := caseToStr[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("%d", int(c))
+}
+
+// Parse a case from its string representation.
+func ParseCase(s string) (Case, error) {
+	for c, name := range caseToStr {
+		if name == s {
+			return c, nil
+		}
+	}
+	return CaseAsIs, fmt.Errorf("unsupported identifier case '%s'.", s)
+}
+
+// Convert an identifier to the case.
+func (c Case) Convert(ident string) string {
+	if c == CaseAsIs {
+		return ident
+	}
+	words := splitWords(ident)
+	for i, w := range words {
+		switch {
+		case c == CaseUpperSnake:
+			words[i] = strings.ToUpper(w)
+		case c == CaseCamel && i == 0, c == CaseSnake:
+			words[i] = strings.ToLower(w)
+		default:
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	if c == CaseSnake || c == CaseUpperSnake {
+		return strings.Join(words, "_")
+	}
+	return strings.Join(words, "")
+}
+
+// Split a camel case identifier into words. Runs of capital letters are
+// treated as acronyms ("httpURLPath" is split into "http", "URL" and "Path")
+// and digits belong to the preceding word.
+func splitWords(ident string) []string {
+	var words []string
+	runes := []rune(ident)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		r, prev := runes[i], runes[i-1]
+		newWord := unicode.IsUpper(r) && !unicode.IsUpper(prev) ||
+			unicode.IsUpper(r) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if newWord {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// Naming holds the identifier cases used for a target language.
+type Naming struct {
+	Field     Case // Message field names.
+	EnumValue Case // Enum value names.
+}
+
+// Returns the default naming of a target language.
+func DefaultNaming(lang string) Naming {
+	if lang == "go" {
+		return Naming{Field: CasePascal, EnumValue: CasePascal}
+	}
+	return Naming{Field: CaseAsIs, EnumValue: CaseAsIs}
+}
+
+// Records identifiers of a scope converted to a target language case to
+// detect collisions.
+type convertedNames map[string]ErrorCtx
+
+// Check that an identifier does not collide with previously added identifiers
+// after conversion to the case.
+func (p *Parser) checkConvertedName(names convertedNames, c Case, item Item) error {
+	converted := c.Convert(item.Value)
+	if ctx, ok := names[converted]; ok && ctx.item.Value != item.Value {
+		return fmt.Errorf("collides with '%v' at %s when converted to %s case ('%s')",
+			ctx.item, ctx.Position(), c, converted)
+	}
+	names[converted] = p.errorCtx(item)
+	return nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Option is a "name = value" declaration carrying settings for code
+// generators.
+type Option struct {
+	Name     string   // Name of the option.
+	Kind     ItemKind // ItemStringLiteral, ItemNumber or ItemIdentifier.
+	Value    string   // Unquoted string, number or identifier.
+	errorCtx ErrorCtx
+}
+
+func (o *Option) String() string {
+	if o.Kind == ItemStringLiteral {
+		return fmt.Sprintf("%s = %q", o.Name, o.Value)
+	}
+	return fmt.Sprintf("%s = %s", o.Name, o.Value)
+}
+
+// Options known by the compiler, the values of other options are not checked.
+type knownOption struct {
+	kind       ItemKind           // Required kind of value.
+	check      func(string) error // Validates the value.
+	perPackage bool               // All files of a package must agree on the value.
+}
+
+var optionKindName = map[ItemKind]string{
+	ItemStringLiteral: "a string",
+	ItemNumber:        "a number",
+	ItemIdentifier:    "an identifier",
+}
+
+// Known file level options.
+var fileOptions = map[string]knownOption{
+	"goPackage":  {ItemStringLiteral, checkGoPackage, true},  // Go import path of the generated package.
+	"cPrefix":    {ItemStringLiteral, checkCPrefix, true},    // Prefix of C identifiers in the generated code.
+	"version":    {ItemNumber, checkVersion, true},           // Version of the schema.
+	"conditions": {ItemStringLiteral, checkConditions, true}, // Conditions messages and fields may depend on.
+}
+
+// Known enum options.
+var enumOptions = map[string]knownOption{
+	"allowAlias": {ItemIdentifier, checkBool, false}, // Several enum values may share a number.
+	"open":       {ItemIdentifier, checkBool, false}, // Unknown values are kept (true) or rejected (false) when decoding.
+}
+
+// Known message options.
+var messageOptions = map[string]knownOption{
+	"when":  {ItemStringLiteral, checkConditions, false}, // Conditions the message is generated for.
+	"topic": {ItemStringLiteral, checkTopic, false},      // MQTT topic template the message is published on.
+}
+
+// Position of the option value.
+func (o *Option) Pos() Pos {
+	return o.errorCtx.pos()
+}
+
+// Returns true if the option value is the identifier "true".
+func (o *Option) Bool() bool {
+	return o.Kind == ItemIdentifier && o.Value == "true"
+}
+
+// Returns the options declared in a file in declaration order.
+func (p *Parser) FileOptions(filename string) []Option {
+	return p.fileOptions[filename]
+}
+
+// Returns the value of a package option or "" if it is not set.
+func (p *Parser) PackageOption(packageName, name string) string {
+	return p.packageOptions[packageName][name].Value
+}
+
+// Parse a file level option declaration, the "option" keyword has already
+// been seen.
+func (p *Parser) parseOption() {
+	if !p.checkPackageDeclared() {
+		return
+	}
+	if option, name, ok := p.parseOptionDecl(fileOptions); ok {
+		p.addOption(name, option)
+	}
+}
+
+// Parse an option declaration, the "option" keyword has already been seen.
+// The values of known options are checked. The option and its name item are
+// returned.
+func (p *Parser) parseOptionDecl(known map[string]knownOption) (Option, Item, bool) {
+	if !p.expect(ItemIdentifier) {
+		return Option{}, Item{}, false
+	}
+	name := p.prev
+	if !(p.expect(ItemEqual) && p.parseOptionValue()) {
+		return Option{}, Item{}, false
+	}
+	valueItem := p.prev
+	option := p.newOption(name, valueItem)
+	check := func(Item) error { return option.checkKnown(known) }
+	if p.check(valueItem, check) && p.expect(ItemEol) {
+		return option, name, true
+	}
+	return Option{}, Item{}, false
+}
+
+// Create an option from its name and value items.
+func (p *Parser) newOption(name, valueItem Item) Option {
+	option := Option{Name: name.Value, Kind: valueItem.Kind, Value: valueItem.Value, errorCtx: p.errorCtx(valueItem)}
+	if option.Kind == ItemStringLiteral {
+		option.Value, _ = strconv.Unquote(valueItem.Value)
+	}
+	return option
+}
+
+// Parse the value of an option. A negative number is returned as a single
+// number item.
+func (p *Parser) parseOptionValue() bool {
+	if p.accept(ItemMinus) {
+		minus := p.prev
+		if !p.expect(ItemNumber) {
+			return false
+		}
+		p.prev = Item{ItemNumber, "-" + p.prev.Value, minus.Pos}
+		return true
+	}
+	if p.accept(ItemStringLiteral) || p.accept(ItemNumber) || p.accept(ItemIdentifier) {
+		return true
+	}
+	p.itemError(p.next, errors.New("expected option value"))
+	return false
+}
+
+// Check the value of an option if it's one of the known options.
+func (o *Option) checkKnown(known map[string]knownOption) error {
+	k, ok := known[o.Name]
+	switch {
+	case !ok:
+		return nil
+	case o.Kind != k.kind:
+		return fmt.Errorf("%s expects %s value", o.Name, optionKindName[k.kind])
+	}
+	return k.check(o.Value)
+}
+
+// Add an option to the current file. All files of a package must agree on the
+// values of package options.
+func (p *Parser) addOption(name Item, option Option) {
+	if p.fileOptions == nil {
+		p.fileOptions = make(map[string][]Option)
+		p.packageOptions = make(map[string]map[string]Option)
+	}
+	if known, ok := fileOptions[option.Name]; ok && known.perPackage {
+		options := p.packageOptions[p.packageName]
+		if options == nil {
+			options = make(map[string]Option)
+			p.packageOptions[p.packageName] = options
+		}
+		if prev, ok := options[option.Name]; ok && prev.Value != option.Value {
+			p.semanticError(name, fmt.Errorf("conflicts with %v at %s", &prev, prev.errorCtx.Position()))
+			return
+		}
+		options[option.Name] = option
+	}
+	p.fileOptions[p.lexer.Name] = append(p.fileOptions[p.lexer.Name], option)
+	pkg := p.pkg()
+	pkg.Options = append(pkg.Options, option)
+}
+
+// Check that value is a boolean identifier.
+func checkBool(value string) error {
+	if value != "true" && value != "false" {
+		return errors.New("expected true or false")
+	}
+	return nil
+}
+
+// Check that value is a schema version number.
+func checkVersion(value string) error {
+	if n, err := strconv.ParseUint(value, 10, 32); err != nil || n == 0 {
+		return errors.New("expected version number in range [1,4294967295]")
+	}
+	return nil
+}
+
+// Check that value is a plausible Go import path.
+func checkGoPackage(value string) error {
+	if value == "" || strings.ContainsAny(value, " \t\"'`\\") {
+		return errors.New("invalid Go import path")
+	}
+	for _, elem := range strings.Split(value, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return errors.New("invalid Go import path")
+		}
+	}
+	return nil
+}
+
+var cIdentifierPrefix = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Check that value can be used to prefix C identifiers.
+func checkCPrefix(value string) error {
+	if !cIdentifierPrefix.MatchString(value) {
+		return errors.New("invalid C identifier prefix")
+	}
+	return nil
+}
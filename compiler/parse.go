@@ -0,0 +1,917 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Default upper limit of fixed array sizes.
+	DefaultMaxArraySize = 65535
+
+	// Valid range of message and choice field tags.
+	minTag = 1
+	maxTag = 1<<29 - 1
+
+	// Tags in the range [reservedTagBegin, maxTag] are reserved for internal use.
+	reservedTagBegin = maxTag - 1023
+
+	// Largest enum value.
+	maxEnumValue = 1<<32 - 1
+)
+
+// Read a file that is not larger than maxSize bytes from fsys, or from the
+// operating system if fsys is nil.
+func readFile(fsys fs.FS, filename string, maxSize int) (string, error) {
+	var file fs.File
+	var err error
+	if fsys != nil {
+		file, err = fsys.Open(filename)
+	} else {
+		file, err = os.Open(filename)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(file, int64(maxSize)+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxSize {
+		return "", &FileSizeError{filename, maxSize}
+	}
+	return string(data), nil
+}
+
+// Parser holds the state from parsing one or more files.
+type Parser struct {
+	lexer       *Lexer  // Lexer used to parse the current file.
+	prev        Item    // Previous item from lexer (accepted).
+	next        Item    // Next item from lexer (to be accepted).
+	errors      []error // Errors found by the lexer or parser in the current file.
+	packageName string  // Current package that is being parsed.
+	limits      Limits  // Limits with defaults applied.
+	tokens      int     // Number of tokens consumed from the current file.
+	depth       int     // Current nesting depth of definitions.
+	parsingStd  bool    // The standard package is being parsed.
+
+	ctx context.Context // Stops parsing when done, may be nil.
+
+	strings *StringTable // Identifiers interned across all parsed files.
+
+	fileOptions        map[string][]Option             // Options by file name.
+	packageOptions     map[string]map[string]Option    // Package options by package and option name.
+	constants          map[string]map[string]*constant // Constants by package and name.
+	types              []typeDecl                      // Types in declaration order.
+	inlineEnums        int                             // Number of anonymous enums.
+	unknownAnnotations map[string]int                  // Uses of annotations not known by the compiler.
+	packages           map[string]*Package             // Syntax trees by package name.
+	imports            []string                        // Files imported by the current file.
+	parsed             map[string]string               // Packages of the files parsed by cleaned name.
+	readTime           time.Duration                   // Time spent reading files.
+
+	// Target language (c|go), names colliding with its keywords are rejected.
+	Lang string
+
+	// Identifier cases used by the target language, names colliding after
+	// conversion are rejected.
+	Naming Naming
+
+	// Upper limit of fixed array sizes, DefaultMaxArraySize is used if zero.
+	MaxArraySize uint64
+
+	// Limits protecting against pathological input.
+	Limits Limits
+
+	// Progress is logged at level info and details useful when debugging
+	// the compiler at level debug, nothing is logged if nil.
+	Logger *slog.Logger
+
+	// File system files are read from, the operating system is used if nil.
+	// Names of files must then be unrooted slash separated paths.
+	FS fs.FS
+
+	// Directories searched for imported files after the directory of the
+	// importing file, in order.
+	IncludePaths []string
+
+	// Reject float64 types, for targets without double precision floating
+	// point support.
+	NoFloat64 bool
+
+	// Require maxlen annotations on strings and dynamic arrays, for targets
+	// without dynamic memory allocation.
+	RequireMaxLen bool
+}
+
+// Parse a file and the files it imports. Files already parsed, e.g. imported
+// by another file, are skipped. The errors found in the files are returned.
+func (p *Parser) ParseFile(filename string) (bool, []error) {
+	if p.isParsed(filename) {
+		return true, nil
+	}
+	start := time.Now()
+	p.log().Info("parsing", "file", filename)
+	text, err := readFile(p.FS, filename, p.Limits.withDefaults().FileSize)
+	p.readTime += time.Since(start)
+	if err != nil {
+		return false, []error{err}
+	}
+	p.log().Debug("read", "file", filename, "bytes", len(text), "duration", time.Since(start))
+	ok, errs := p.ParseText(filename, text)
+	p.log().Info("parsed", "file", filename, "duration", time.Since(start), "errors", len(errs))
+	return ok, errs
+}
+
+// Returns the package of the file parsed last.
+func (p *Parser) PackageName() string {
+	return p.packageName
+}
+
+// Parse text from a file with the specified name. Files imported by the text
+// are parsed after it unless already parsed. The errors found in the text and
+// the imported files are returned.
+func (p *Parser) ParseText(name, text string) (bool, []error) {
+	p.errors = nil
+	p.imports = nil
+	p.packageName = ""
+	p.limits = p.Limits.withDefaults()
+	p.tokens = 0
+	p.depth = 0
+	if len(text) > p.limits.FileSize {
+		return false, []error{&FileSizeError{name, p.limits.FileSize}}
+	}
+	if p.strings == nil {
+		p.strings = NewStringTable()
+	}
+	if !p.parsingStd {
+		p.markParsed(name)
+	}
+	p.lexer = NewLexer(name, text, p.strings)
+	/* Seed the parser by fetching the first token from the lexer. */
+	p.next = p.lexer.NextItem()
+	p.checkItemLimits()
+	p.parseRoot()
+	p.lexer.Close()
+	p.log().Debug("lexed", "file", name, "package", p.packageName, "tokens", p.tokens, "identifiers", len(p.strings.strings))
+	for _, option := range p.FileOptions(name) {
+		p.log().Debug("option", "file", name, "option", &option)
+	}
+	return p.parseImports()
+}
+
+// Get the next item from the lexer.
+func (p *Parser) consume() {
+	p.prev = p.next
+	if p.next.Kind != ItemEof && p.next.Kind != ItemError {
+		p.next = p.lexer.NextItem()
+		p.checkItemLimits()
+	}
+}
+
+// Accept the next item if it's of the specified kind.
+func (p *Parser) accept(kind ItemKind) bool {
+	if p.next.Kind != kind {
+		return false
+	}
+	p.consume()
+	return true
+}
+
+// Same as accept but let the supplied function do the matching.
+func (p *Parser) acceptM(fn func(Item) error) bool {
+	if err := fn(p.next); err != nil {
+		return false
+	}
+	p.consume()
+	return true
+}
+
+// Expect the next item to be of the specified kind, if it's not an error will
+// be pushed onto the parsers error list.
+func (p *Parser) expect(kind ItemKind) bool {
+	if p.next.Kind != kind {
+		p.itemError(p.next, fmt.Errorf("expected %s", kind))
+		return false
+	}
+	p.consume()
+	return true
+}
+
+// Same as expect but let the supplied function do the matching.
+func (p *Parser) expectM(fn func(Item) error) bool {
+	if err := fn(p.next); err != nil {
+		p.itemError(p.next, err)
+		return false
+	}
+	p.consume()
+	return true
+}
+
+// Check the parser error state.
+func (p *Parser) ok() bool {
+	return len(p.errors) == 0
+}
+
+type ErrorCtx struct {
+	lexer *Lexer
+	item  Item
+}
+
+// Position of the item in "file:line:column" format.
+func (ctx *ErrorCtx) Position() string {
+	line := ctx.lexer.LineNumber(ctx.item)
+	column := ctx.lexer.ColumnNumber(ctx.item)
+	return fmt.Sprintf("%s:%d:%d", ctx.lexer.Name, line, column)
+}
+
+func (ctx *ErrorCtx) Error(details error) *Diagnostic {
+	d := &Diagnostic{
+		File:   ctx.lexer.Name,
+		Line:   ctx.lexer.LineNumber(ctx.item),
+		Column: ctx.lexer.ColumnNumber(ctx.item),
+	}
+	if ctx.item.Kind == ItemError {
+		d.Msg = ctx.item.String()
+	} else {
+		if details == nil {
+			details = errors.New("unexpected token")
+		}
+		d.Msg = fmt.Sprintf("at '%v', %s.", ctx.item, details)
+	}
+	return d
+}
+
+// Create an error context based on current lexer and item information.
+// The error context can be used at a later time for correct error reporting.
+func (p *Parser) errorCtx(item Item) ErrorCtx {
+	return ErrorCtx{p.lexer, item}
+}
+
+// Report an error while parsing an item from the current lexer.
+func (p *Parser) itemError(item Item, details error) {
+	p.pushError(p.errorCtx(item), details)
+}
+
+// Report an error based on an error context.
+func (p *Parser) pushError(ctx ErrorCtx, details error) {
+	p.errors = append(p.errors, ctx.Error(details))
+}
+
+// Report a semantic error, an error in syntactically valid input, while
+// parsing an item from the current lexer.
+func (p *Parser) semanticError(item Item, details error) {
+	p.pushSemanticError(p.errorCtx(item), details)
+}
+
+// Report a semantic error based on an error context.
+func (p *Parser) pushSemanticError(ctx ErrorCtx, details error) {
+	d := ctx.Error(details)
+	d.Semantic = true
+	p.errors = append(p.errors, d)
+}
+
+// Match positive numbers (numbers greater than zero).
+func matchPositiveNumber(item Item) error {
+	if item.Kind == ItemNumber {
+		r := item.Value[0]
+		if '1' <= r && r <= '9' {
+			return nil
+		}
+	}
+	return errors.New("expected positive number")
+}
+
+// BigIdentifier match function.
+func matchBigIdentifier(item Item) error {
+	if item.Kind == ItemIdentifier {
+		r := item.Value[0]
+		if 'A' <= r && r <= 'Z' {
+			return nil
+		}
+	}
+	return errors.New("expected capitalized identifier")
+}
+
+// LittleIdentifier match function.
+func matchLittleIdentifier(item Item) error {
+	if item.Kind == ItemIdentifier {
+		r := item.Value[0]
+		if 'a' <= r && r <= 'z' {
+			return nil
+		}
+	}
+	return errors.New("expected uncapitalized identifier")
+}
+
+// Reports whether s is a LittleIdentifier.
+func isLittleIdentifier(s string) bool {
+	for i, r := range s {
+		if !(isLetter(r) || i > 0 && isDigit(r)) || i == 0 && !('a' <= r && r <= 'z') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Message field name match function. Keywords are accepted as field names
+// since the preceding tag makes them unambiguous.
+func matchFieldName(item Item) error {
+	if item.isKeyword() {
+		return nil
+	}
+	return matchLittleIdentifier(item)
+}
+
+// BasicType match function.
+func matchBasicType(item Item) error {
+	if item.Kind > ItemBasicTypeBegin && item.Kind < ItemBasicTypeEnd {
+		return nil
+	}
+	return errors.New("expected basic type")
+}
+
+// Parse the numeric value of a number item.
+func parseNumber(item Item) (uint64, error) {
+	n, err := strconv.ParseUint(item.Value, 10, 64)
+	if err != nil {
+		return 0, errors.New("number out of range")
+	}
+	return n, nil
+}
+
+// Check that a number item is a valid message or choice field tag.
+func checkTag(item Item) error {
+	n, err := parseNumber(item)
+	switch {
+	case err != nil || n < minTag || n > maxTag:
+		return fmt.Errorf("tag out of range [%d,%d]", minTag, maxTag)
+	case n >= reservedTagBegin:
+		return fmt.Errorf("tags in range [%d,%d] are reserved for internal use", reservedTagBegin, maxTag)
+	}
+	return nil
+}
+
+// Check that a number item is a valid enum value.
+func checkEnumValue(item Item) error {
+	if n, err := parseNumber(item); err != nil || n > maxEnumValue {
+		return fmt.Errorf("enum value out of range [0,%d]", uint64(maxEnumValue))
+	}
+	return nil
+}
+
+// Check that an evaluated constant expression is a valid fixed array size.
+func checkArraySize(size *big.Int, max uint64) error {
+	if size.Sign() <= 0 || !size.IsUint64() || size.Uint64() > max {
+		return fmt.Errorf("array size out of range [1,%d]", max)
+	}
+	return nil
+}
+
+// Check an accepted item with the supplied function, if it fails a semantic
+// error will be pushed onto the parsers error list.
+func (p *Parser) check(item Item, fn func(Item) error) bool {
+	if err := fn(item); err != nil {
+		p.semanticError(item, err)
+		return false
+	}
+	return true
+}
+
+// Check that the package of the file is declared, the keyword of a top
+// level declaration has just been accepted.
+func (p *Parser) checkPackageDeclared() bool {
+	if p.packageName == "" {
+		p.itemError(p.prev, fmt.Errorf("%v declared before package", p.prev.Kind))
+		return false
+	}
+	return true
+}
+
+// Top level parser.
+func (p *Parser) parseRoot() {
+out:
+	for p.ok() {
+		switch {
+		case p.accept(ItemEol):
+		case p.accept(ItemChoice):
+			p.parseChoice()
+		case p.accept(ItemConst):
+			p.parseConst()
+		case p.accept(ItemEnum):
+			p.parseEnum()
+		case p.accept(ItemImport):
+			p.parseImport()
+		case p.accept(ItemMessage):
+			p.parseMessage()
+		case p.accept(ItemOption):
+			p.parseOption()
+		case p.accept(ItemPackage):
+			p.parsePackage()
+		case p.accept(ItemType):
+			p.parseType()
+		case p.accept(ItemEof):
+			if p.packageName == "" {
+				p.itemError(p.prev, errors.New("missing package declaration"))
+			}
+			break out
+		default:
+			p.itemError(p.next, nil)
+		}
+	}
+}
+
+func (p *Parser) parseChoice() {
+	if !p.enterDepth() {
+		return
+	}
+	defer p.leaveDepth()
+	if p.checkPackageDeclared() && p.expectM(matchBigIdentifier) && p.declareType(ItemChoice) {
+		node := &Choice{Pos: p.pos(p.prev), Name: p.prev.Value}
+		if !p.expect(ItemEol) {
+			return
+		}
+		pkg := p.pkg()
+		pkg.Choices = append(pkg.Choices, node)
+		scope := choiceScope{names: make(convertedNames), items: make(map[string]Item), node: node}
+		for p.ok() && !p.accept(ItemEnd) {
+			p.parseChoiceField(&scope)
+		}
+		p.countMembers(len(node.Alternatives))
+	}
+}
+
+// State of the choice being parsed.
+type choiceScope struct {
+	names    convertedNames  // Alternative names converted to the target language case.
+	items    map[string]Item // Alternatives by name.
+	fallback *Option         // Fallback annotation of the choice, if any.
+	node     *Choice         // Syntax tree node of the choice.
+}
+
+// Parse a choice alternative ("tag: [name] type"). A leading identifier is
+// the name of the alternative unless it is followed by a dot or the end of
+// the line, then it begins the type. Likewise a leading basic type is the
+// type unless another type follows. Unnamed alternatives are named after
+// their type. Annotations may follow the type.
+func (p *Parser) parseChoiceField(scope *choiceScope) {
+	var tag Item
+	if !p.parseTag(&tag) {
+		return
+	}
+	var ok bool
+	var ft FieldType
+	if !p.acceptM(matchFieldName) {
+		var id FqTypeIdentifier
+		ok = p.parseFqTypeIdentifier(&id) && p.referType(id, nil) && p.addChoiceField(scope, p.prev, id.alternativeName())
+		ft.Type = &id
+	} else if first := p.prev; first.Kind == ItemIdentifier && (p.next.Kind == ItemDot || p.next.Kind == ItemEol) {
+		var id FqTypeIdentifier
+		ok = p.parseFqTypeIdentifierRest(&id) && p.referType(id, nil) && p.addChoiceField(scope, p.prev, id.alternativeName())
+		ft.Type = &id
+	} else if matchBasicType(first) == nil && (p.next.Kind == ItemEol || p.next.Kind == ItemLeftAngle || p.next.Kind == ItemLeftBracket) {
+		ft.Basic = first.Kind
+		ok = p.check(first, p.checkBasicType) && (ft.Basic != ItemFixed && ft.Basic != ItemUfixed || p.parseFixedPoint(&ft)) &&
+			p.checkCapacity(first, &ft, false, nil) && p.addChoiceField(scope, first, first.Value)
+	} else {
+		ok = p.addChoiceField(scope, first, first.Value) && p.parseMessageFieldType(&ft) && p.checkCapacity(first, &ft, false, nil)
+	}
+	if !ok {
+		return
+	}
+	if annotations, ok := p.parseAnnotations(choiceFieldAnnotations); ok && p.checkFallback(scope, annotations) && p.expect(ItemEol) {
+		node := scope.node.Alternatives[len(scope.node.Alternatives)-1]
+		node.Tag, _ = parseNumber(tag)
+		node.Type, node.Annotations = ft, annotations
+	}
+}
+
+// Add an alternative name to a choice, item is used for error reporting.
+// Default names derived from the type are checked like declared names.
+func (p *Parser) addChoiceField(scope *choiceScope, item Item, name string) bool {
+	nameItem := Item{ItemIdentifier, name, item.Pos}
+	if !(p.check(nameItem, p.checkFieldName) && p.check(nameItem, func(item Item) error {
+		return p.checkConvertedName(scope.names, p.Naming.Field, item)
+	})) {
+		return false
+	}
+	if prev, ok := scope.items[name]; ok {
+		ctx := p.errorCtx(prev)
+		p.semanticError(item, fmt.Errorf("alternative name %s also used at %s", name, ctx.Position()))
+		return false
+	}
+	scope.items[name] = item
+	scope.node.Alternatives = append(scope.node.Alternatives, &ChoiceField{Pos: p.pos(item), Name: name})
+	return true
+}
+
+// Returns the default name of a choice alternative of the type, the package
+// and type name components in camel case ("paint.brushes.Size" becomes
+// "paintBrushesSize").
+func (t *FqTypeIdentifier) alternativeName() string {
+	var b strings.Builder
+	if t.PackageName != "" {
+		for _, s := range strings.Split(t.PackageName, ".") {
+			b.WriteString(strings.ToUpper(s[:1]) + s[1:])
+		}
+	}
+	b.WriteString(t.TypeName)
+	name := b.String()
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func (p *Parser) parseEnum() {
+	if !p.enterDepth() {
+		return
+	}
+	defer p.leaveDepth()
+	if p.checkPackageDeclared() && p.expectM(matchBigIdentifier) && p.declareType(ItemEnum) {
+		node := &Enum{Pos: p.pos(p.prev), Name: p.prev.Value}
+		pkg := p.pkg()
+		pkg.Enums = append(pkg.Enums, node)
+		p.parseEnumBody(node)
+		p.countMembers(len(node.Values))
+	}
+}
+
+// Parse an anonymous enum declared as the type of a message field, the "enum"
+// keyword has already been seen.
+func (p *Parser) parseInlineEnum(ft *FieldType) bool {
+	if !p.enterDepth() {
+		return false
+	}
+	defer p.leaveDepth()
+	if !p.parsingStd {
+		p.inlineEnums++
+	}
+	ft.Enum = &Enum{Pos: p.pos(p.prev)}
+	p.parseEnumBody(ft.Enum)
+	return p.ok()
+}
+
+// State of the enum being parsed.
+type enumScope struct {
+	names  convertedNames // Value names converted to the target language case.
+	values []Item         // Value numbers.
+	node   *Enum          // Syntax tree node of the enum.
+}
+
+// Parse the values and options of an enum up to and including the "end"
+// keyword into node.
+func (p *Parser) parseEnumBody(node *Enum) {
+	if p.expect(ItemEol) {
+		scope := enumScope{names: make(convertedNames), node: node}
+		for p.ok() && !p.accept(ItemEnd) {
+			if p.accept(ItemOption) {
+				if option, _, ok := p.parseOptionDecl(enumOptions); ok {
+					node.Options = append(node.Options, option)
+				}
+			} else {
+				p.parseEnumField(&scope)
+			}
+		}
+		if p.ok() {
+			p.checkEnumAliases(&scope)
+		}
+	}
+}
+
+func (p *Parser) parseEnumField(scope *enumScope) {
+	if p.expect(ItemNumber) && p.check(p.prev, checkEnumValue) {
+		number := p.prev
+		scope.values = append(scope.values, number)
+		if p.expect(ItemColon) && p.expectM(matchBigIdentifier) && p.checkCase(scope.names, p.Naming.EnumValue) {
+			name := p.prev
+			if p.expect(ItemEol) {
+				value, _ := parseNumber(number)
+				scope.node.Values = append(scope.node.Values, &EnumValue{p.pos(name), name.Value, value})
+			}
+		}
+	}
+}
+
+// Check that enum values are unique unless aliases are allowed.
+func (p *Parser) checkEnumAliases(scope *enumScope) {
+	for _, option := range scope.node.Options {
+		if option.Name == "allowAlias" && option.Bool() {
+			return
+		}
+	}
+	seen := make(map[uint64]Item)
+	for _, item := range scope.values {
+		n, _ := parseNumber(item)
+		if prev, ok := seen[n]; ok {
+			ctx := p.errorCtx(prev)
+			p.semanticError(item, fmt.Errorf("value also used at %s, set option allowAlias = true to allow aliases", ctx.Position()))
+			continue
+		}
+		seen[n] = item
+	}
+}
+
+// State of the message being parsed.
+type messageScope struct {
+	names convertedNames // Field names converted to the target language case.
+	tags  []Item         // Field tags.
+	node  *Message       // Syntax tree node of the message.
+}
+
+func (p *Parser) parseMessage() {
+	if !p.enterDepth() {
+		return
+	}
+	defer p.leaveDepth()
+	if p.checkPackageDeclared() && p.expectM(matchBigIdentifier) && p.declareType(ItemMessage) {
+		node := &Message{Pos: p.pos(p.prev), Name: p.prev.Value}
+		if !p.expect(ItemEol) {
+			return
+		}
+		pkg := p.pkg()
+		pkg.Messages = append(pkg.Messages, node)
+		scope := messageScope{names: make(convertedNames), node: node}
+		for p.ok() && !p.accept(ItemEnd) {
+			if p.accept(ItemExtensions) {
+				p.parseExtensions(&scope)
+			} else if p.accept(ItemOption) {
+				if option, _, ok := p.parseOptionDecl(messageOptions); ok {
+					node.Options = append(node.Options, option)
+				}
+			} else {
+				p.parseMessageField(&scope)
+			}
+		}
+		p.countMembers(len(scope.tags))
+		if p.ok() && p.checkTopicFields(&scope, findAnnotation(node.Options, "topic")) {
+			p.checkExtensions(&scope)
+		}
+	}
+}
+
+func (p *Parser) parseMessageField(scope *messageScope) {
+	var tag Item
+	if p.parseTag(&tag) && p.expectM(matchFieldName) && p.check(p.prev, p.checkFieldName) &&
+		p.checkCase(scope.names, p.Naming.Field) {
+		name := p.prev
+		scope.tags = append(scope.tags, tag)
+		optional := p.accept(ItemOptional)
+		var ft FieldType
+		if !(p.parseArray(&ft) && p.parseMessageFieldTypeOrEnum(&ft)) {
+			return
+		}
+		if annotations, ok := p.parseAnnotations(fieldAnnotations); ok && p.checkVersionAnnotations(annotations) &&
+			p.checkConstraintAnnotations(annotations, &ft) && p.checkCapacity(name, &ft, true, findAnnotation(annotations, "maxlen")) &&
+			p.expect(ItemEol) {
+			n, _ := parseNumber(tag)
+			scope.node.Fields = append(scope.node.Fields, &Field{Pos: p.pos(name), Tag: n, Name: name.Value, Type: ft, Optional: optional, Annotations: annotations})
+		}
+	}
+}
+
+// Parse a range of tags reserved for extensions ("first to last"), the
+// "extensions" keyword has already been seen.
+func (p *Parser) parseExtensions(scope *messageScope) {
+	if !(p.expectM(matchPositiveNumber) && p.check(p.prev, checkTag)) {
+		return
+	}
+	firstItem := p.prev
+	if !(p.expect(ItemTo) && p.expectM(matchPositiveNumber) && p.check(p.prev, checkTag)) {
+		return
+	}
+	first, _ := parseNumber(firstItem)
+	last, _ := parseNumber(p.prev)
+	if first > last {
+		p.semanticError(firstItem, errors.New("extension range is empty"))
+		return
+	}
+	for _, r := range scope.node.Extensions {
+		if first <= r.Last && r.First <= last {
+			p.semanticError(firstItem, fmt.Errorf("extension range overlaps range at %s", r.Pos))
+			return
+		}
+	}
+	if p.expect(ItemEol) {
+		scope.node.Extensions = append(scope.node.Extensions, ExtensionRange{p.pos(firstItem), first, last})
+	}
+}
+
+// Check that no field tags of a message are reserved for extensions.
+func (p *Parser) checkExtensions(scope *messageScope) {
+	for _, tag := range scope.tags {
+		n, _ := parseNumber(tag)
+		for _, r := range scope.node.Extensions {
+			if r.First <= n && n <= r.Last {
+				p.semanticError(tag, fmt.Errorf("tag is reserved for extensions by range at %s", r.Pos))
+			}
+		}
+	}
+}
+
+// Parse the parameters of a fixed point type ("<IntBits, FracBits>"), the
+// "fixed" or "ufixed" keyword has already been seen.
+func (p *Parser) parseFixedPoint(ft *FieldType) bool {
+	typeItem := p.prev
+	if !(p.expect(ItemLeftAngle) && p.expectM(matchPositiveNumber) && p.check(p.prev, checkFixedPointBits)) {
+		return false
+	}
+	ft.IntBits, _ = parseNumber(p.prev)
+	if !(p.expect(ItemComma) && p.expectM(matchPositiveNumber) && p.check(p.prev, checkFixedPointBits)) {
+		return false
+	}
+	ft.FracBits, _ = parseNumber(p.prev)
+	if !p.expect(ItemRightAngle) {
+		return false
+	}
+	switch ft.IntBits + ft.FracBits {
+	case 8, 16, 32, 64:
+		return true
+	}
+	p.semanticError(typeItem, errors.New("fixed point types must have 8, 16, 32 or 64 bits in total"))
+	return false
+}
+
+// Check that a number item is a valid bit count of a fixed point type.
+func checkFixedPointBits(item Item) error {
+	if n, err := parseNumber(item); err != nil || n > 64 {
+		return errors.New("bit count out of range [1,64]")
+	}
+	return nil
+}
+
+func (p *Parser) parseMessageFieldType(ft *FieldType) bool {
+	if p.acceptM(matchBasicType) {
+		ft.Basic = p.prev.Kind
+		if p.check(p.prev, p.checkBasicType) && (ft.Basic == ItemFixed || ft.Basic == ItemUfixed) {
+			p.parseFixedPoint(ft)
+		}
+	} else {
+		var id FqTypeIdentifier
+		if p.parseFqTypeIdentifier(&id) && p.referType(id, ft) {
+			ft.Type = &id
+		}
+	}
+	return p.ok()
+}
+
+// Same as parseMessageFieldType but also accept anonymous enums and maps.
+func (p *Parser) parseMessageFieldTypeOrEnum(ft *FieldType) bool {
+	if p.accept(ItemEnum) {
+		return p.parseInlineEnum(ft)
+	}
+	if p.accept(ItemMap) {
+		if ft.Array != ArrayNone {
+			p.semanticError(p.prev, errors.New("arrays of maps are not supported"))
+			return false
+		}
+		return p.parseMap(ft)
+	}
+	return p.parseMessageFieldType(ft)
+}
+
+// Basic types allowed as map keys.
+var mapKeyTypes = map[ItemKind]bool{
+	ItemByte: true, ItemString: true,
+	ItemInt8: true, ItemInt16: true, ItemInt32: true, ItemInt64: true,
+	ItemUint8: true, ItemUint16: true, ItemUint32: true, ItemUint64: true,
+}
+
+// Parse a map type ("map[KeyType] [Array] ValueType"), the "map" keyword has
+// already been seen. Named key types must be enums, which is checked when
+// resolving types. Map values are allocated separately and do not contain
+// the message by value.
+func (p *Parser) parseMap(ft *FieldType) bool {
+	m := &MapType{}
+	ft.Map = m
+	if !p.expect(ItemLeftBracket) {
+		return false
+	}
+	keyItem := p.next
+	if !p.parseMessageFieldType(&m.Key) {
+		return false
+	}
+	if m.Key.Type != nil {
+		p.lastRef().mapKey = true
+	} else if !mapKeyTypes[m.Key.Basic] {
+		p.semanticError(keyItem, errors.New("map keys must be integers, strings or enums"))
+		return false
+	}
+	if !(p.expect(ItemRightBracket) && p.parseArray(&m.Value) && p.parseMessageFieldType(&m.Value)) {
+		return false
+	}
+	if m.Value.Type != nil {
+		p.lastRef().dynamic = true
+	}
+	return true
+}
+
+// Parse a package name, which may consist of several dot separated identifiers.
+func (p *Parser) parsePackage() {
+	if p.packageName != "" {
+		p.itemError(p.prev, errors.New("package already declared"))
+		return
+	}
+	var name []string
+	for p.expect(ItemIdentifier) && p.check(p.prev, p.checkPackageName) {
+		name = append(name, p.prev.Value)
+		if !p.accept(ItemDot) {
+			p.packageName = p.strings.Intern(strings.Join(name, "."))
+			if p.packageName == stdPackage && !p.parsingStd {
+				p.semanticError(p.prev, errors.New("package std is reserved for the standard package"))
+				break
+			}
+			if !p.parsingStd {
+				p.parsed[p.cleanPath(p.lexer.Name)] = p.packageName
+			}
+			p.expect(ItemEol)
+			break
+		}
+	}
+}
+
+func (p *Parser) parseType() {
+	var ft FieldType
+	if p.checkPackageDeclared() && p.expectM(matchBigIdentifier) && p.declareType(ItemType) {
+		name := p.prev
+		if p.parseArray(&ft) && p.parseMessageFieldType(&ft) && p.checkCapacity(name, &ft, false, nil) && p.expect(ItemEol) {
+			pkg := p.pkg()
+			pkg.Types = append(pkg.Types, &TypeAlias{p.pos(name), name.Value, ft})
+		}
+	}
+}
+
+func (p *Parser) parseArray(ft *FieldType) bool {
+	if p.accept(ItemLeftBracket) {
+		ft.Array = ArrayDynamic
+		if p.accept(ItemRightBracket) {
+			return true
+		}
+		start := p.errorCtx(p.next)
+		if expr, ok := p.parseConstExpr(); ok {
+			ft.Array = ArrayFixed
+			ft.size = &arraySize{expr, start}
+			p.expect(ItemRightBracket)
+		}
+	}
+	return p.ok()
+}
+
+// Check that the previously accepted identifier does not collide with other
+// identifiers in the same scope after conversion to the case.
+func (p *Parser) checkCase(names convertedNames, c Case) bool {
+	return p.check(p.prev, func(item Item) error {
+		return p.checkConvertedName(names, c, item)
+	})
+}
+
+// Parse a field tag ("PositiveNumber :"). The number item is stored in tag
+// unless it's nil.
+func (p *Parser) parseTag(tag *Item) bool {
+	if !(p.expectM(matchPositiveNumber) && p.check(p.prev, checkTag)) {
+		return false
+	}
+	if tag != nil {
+		*tag = p.prev
+	}
+	return p.expect(ItemColon)
+}
+
+func (p *Parser) parseFqTypeIdentifier(id *FqTypeIdentifier) bool {
+	return p.expect(ItemIdentifier) && p.parseFqTypeIdentifierRest(id)
+}
+
+// Parse the remainder of a fully qualified type identifier, its first
+// identifier has already been seen. The identifier is stored in id unless
+// it's nil.
+func (p *Parser) parseFqTypeIdentifierRest(id *FqTypeIdentifier) bool {
+	// [ <package> . ] BigIdentifier, where <package> may contain dots.
+	var components []string
+	last := p.prev
+	for p.ok() && p.accept(ItemDot) {
+		components = append(components, last.Value)
+		p.expect(ItemIdentifier)
+		last = p.prev
+	}
+	if p.ok() {
+		if err := matchBigIdentifier(last); err != nil {
+			p.itemError(last, err)
+		} else if id != nil {
+			*id = FqTypeIdentifier{strings.Join(components, "."), last.Value}
+		}
+	}
+	return p.ok()
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// Mutate speak source, seeded with the files in test-data, to find input
+// crashing the lexer, parser or later passes. Imports are resolved against
+// the seed files. Run with go test -fuzz FuzzParse ./compiler.
+func FuzzParse(f *testing.F) {
+	filenames, err := filepath.Glob("../test-data/*.speak")
+	if err != nil {
+		f.Fatal(err)
+	}
+	fsys := fstest.MapFS{}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			f.Fatal(err)
+		}
+		fsys[filepath.Base(filename)] = &fstest.MapFile{Data: data}
+		f.Add(string(data))
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		for _, lang := range []string{"c", "go"} {
+			Parse(&Options{
+				Lang:    lang,
+				Naming:  DefaultNaming(lang),
+				Sources: []Source{{"fuzz.speak", text}},
+				FS:      fsys,
+				Stats:   new(Stats),
+				Timings: new(Timings),
+			})
+		}
+	})
+}
@@ -0,0 +1,345 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// The parser interns package names while lexers of the same and later files
+// are still running, run with -race.
+func TestParsePackageNameRace(t *testing.T) {
+	parser := &Parser{}
+	for i := 0; i < 100; i++ {
+		parser.ParseText("bad.speak", "package a b c d e f g\n")
+		if ok, errs := parser.ParseText("good.speak", "package a.b.c.d.e.f.g\n"); !ok {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if name := parser.PackageName(); name != "a.b.c.d.e.f.g" {
+			t.Fatalf("package name %q, expected a.b.c.d.e.f.g", name)
+		}
+	}
+}
+
+// The package of a file is not replaced by the packages of its imports.
+func TestParseFilePackageNameAfterImports(t *testing.T) {
+	parser := &Parser{FS: fstest.MapFS{
+		"a.speak": {Data: []byte("package a\nimport \"b.speak\"\n")},
+		"b.speak": {Data: []byte("package b\n")},
+	}}
+	if ok, errs := parser.ParseFile("a.speak"); !ok {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if name := parser.PackageName(); name != "a" {
+		t.Fatalf("package name %q, expected a", name)
+	}
+}
+
+// Unary minus signs are nested expressions bounded by the depth limit.
+func TestParseConstMinusDepth(t *testing.T) {
+	parser := &Parser{}
+	text := "package a\nconst X = " + strings.Repeat("-", 3000000) + "1\n"
+	if ok, _ := parser.ParseText("a.speak", text); ok {
+		t.Fatal("expected an error")
+	}
+	if ok, errs := parser.ParseText("b.speak", "package b\nconst X = --1\n"); !ok {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+// Bit counts of fixed point types can not wrap around when added.
+func TestParseFixedPointBits(t *testing.T) {
+	parser := &Parser{}
+	text := "package a\nmessage M\n    1: x fixed<18446744073709551615,17>\nend\n"
+	if ok, _ := parser.ParseText("a.speak", text); ok {
+		t.Fatal("expected an error")
+	}
+}
+
+// Fields of conditional message types must be conditional.
+func TestCheckConditions(t *testing.T) {
+	text := "package a\noption conditions = \"factory\"\n" +
+		"message Cal\n    option when = \"factory\"\n    1: x int8\nend\n" +
+		"message M\n    1: c Cal\n    2: d Cal [when=\"factory\"]\nend\n"
+	_, errs := Parse(&Options{Lang: "go", Naming: DefaultNaming("go"), Sources: []Source{{"a.speak", text}}})
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+}
+
+// Names of anonymous enums collide with declared types.
+func TestCheckDuplicatesInlineEnumName(t *testing.T) {
+	text := "package a\nenum ShapeKind\n    0: X\nend\n" +
+		"message Shape\n    1: kind enum\n        0: Circle\n    end\nend\n"
+	_, errs := Parse(&Options{Lang: "go", Naming: DefaultNaming("go"), Sources: []Source{{"a.speak", text}}})
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+}
+
+// Default names of choice alternatives are checked against C keywords.
+func TestParseChoiceDefaultNameKeyword(t *testing.T) {
+	parser := &Parser{Lang: "c"}
+	if ok, _ := parser.ParseText("a.speak", "package a\nchoice V\n    1: bool\nend\n"); ok {
+		t.Fatal("expected an error")
+	}
+}
+
+// References to the standard package are not dependencies in the statistics.
+func TestStatsFanWithoutStd(t *testing.T) {
+	stats := new(Stats)
+	text := "package a\nmessage M\n    1: t std.Timestamp\nend\n"
+	if _, errs := Parse(&Options{Lang: "go", Naming: DefaultNaming("go"), Stats: stats, Sources: []Source{{"a.speak", text}}}); errs != nil {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(stats.Fan) != 0 {
+		t.Fatalf("unexpected fan %v", stats.Fan)
+	}
+}
+
+// Every file declares its package once, before its other declarations.
+func TestParsePackageDeclaration(t *testing.T) {
+	for _, text := range []string{
+		"message M\nend\n",
+		"type T int8\n",
+		"package a\npackage b\n",
+		"\n",
+	} {
+		parser := &Parser{}
+		if ok, _ := parser.ParseText("a.speak", text); ok {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+// Identifiers are split into words at case changes, acronyms are kept.
+func TestCaseConvert(t *testing.T) {
+	for _, test := range []struct {
+		ident string
+		c     Case
+		want  string
+	}{
+		{"httpURLPath", CaseAsIs, "httpURLPath"},
+		{"httpURLPath", CaseCamel, "httpURLPath"},
+		{"httpURLPath", CasePascal, "HttpURLPath"},
+		{"httpURLPath", CaseSnake, "http_url_path"},
+		{"httpURLPath", CaseUpperSnake, "HTTP_URL_PATH"},
+		{"URLPath", CaseCamel, "urlPath"},
+		{"x2y", CasePascal, "X2y"},
+		{"v2Name", CaseSnake, "v2_name"},
+		{"ID", CaseSnake, "id"},
+		{"a", CaseUpperSnake, "A"},
+	} {
+		if got := test.c.Convert(test.ident); got != test.want {
+			t.Errorf("%s.Convert(%q) = %q, want %q", test.c, test.ident, got, test.want)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for ident, want := range map[string]string{
+		"a":           "a",
+		"fooBar":      "foo Bar",
+		"FooBar":      "Foo Bar",
+		"httpURLPath": "http URL Path",
+		"URL":         "URL",
+		"x2y":         "x2y",
+		"v2Name":      "v2 Name",
+		"ID2Name":     "ID2 Name",
+	} {
+		if got := strings.Join(splitWords(ident), " "); got != want {
+			t.Errorf("splitWords(%q) = %q, want %q", ident, got, want)
+		}
+	}
+}
+
+// Field and alternative names are checked against the keywords of the target
+// language after conversion to the field case.
+func TestCheckFieldNameConverted(t *testing.T) {
+	for _, test := range []struct {
+		lang  string
+		field Case
+		text  string
+		ok    bool
+	}{
+		{"go", CasePascal, "message M\n    1: type int8\nend\n", true},
+		{"go", CaseCamel, "message M\n    1: type int8\nend\n", false},
+		{"go", CaseCamel, "choice C\n    1: func int8\nend\n", false},
+		{"c", CaseAsIs, "message M\n    1: int int8\nend\n", false},
+		{"c", CasePascal, "message M\n    1: int int8\nend\n", true},
+		{"c", CaseCamel, "message M\n    1: int int8\nend\n", false},
+	} {
+		parser := &Parser{Lang: test.lang, Naming: Naming{Field: test.field}}
+		if ok, _ := parser.ParseText("a.speak", "package a\n"+test.text); ok != test.ok {
+			t.Errorf("%s %s %q: ok = %v, want %v", test.lang, test.field, test.text, ok, test.ok)
+		}
+	}
+}
+
+// Topic placeholders refer to string, integer or enum fields.
+func TestCheckTopicFields(t *testing.T) {
+	for _, test := range []struct {
+		field string
+		ok    bool
+	}{
+		{"id string", true},
+		{"id uint32", true},
+		{"id Kind", true},
+		{"id enum\n        0: A\n    end", true},
+		{"id bool", false},
+		{"id float32", false},
+		{"id [4]uint8", false},
+		{"id []string", false},
+		{"id map[string]string", false},
+		{"id Other", false},
+		{"name string", false},
+	} {
+		text := "package a\nenum Kind\n    0: A\nend\nmessage Other\nend\n" +
+			"message M\n    option topic = \"devices/{id}\"\n    1: " + test.field + "\nend\n"
+		_, errs := Parse(&Options{Sources: []Source{{"a.speak", text}}})
+		if ok := len(errs) == 0; ok != test.ok {
+			t.Errorf("%q: ok = %v, want %v (%v)", test.field, ok, test.ok, errs)
+		}
+	}
+}
+
+// Constants are resolved when all files are parsed, in any order.
+func TestResolveConstants(t *testing.T) {
+	for _, test := range []struct {
+		texts []string
+		ok    bool
+	}{
+		{[]string{"package a\nmessage M\n    1: x [N*2]uint8\nend\nconst N = K + 1\nconst K = 3\n"}, true},
+		{[]string{"package a\ntype T [N]uint8\n", "package a\nconst N = 4\n"}, true},
+		{[]string{"package a\ntype T [N]uint8\n", "package b\nconst N = 4\n"}, false},
+		{[]string{"package a\nconst A = B\nconst B = A + 1\n"}, false},
+		{[]string{"package a\nconst A = (A)\n"}, false},
+		{[]string{"package a\nconst N = 4\nconst Z = 1/(N-4)\n"}, false},
+		{[]string{"package a\nconst N = 9223372036854775807\nconst Z = N + 1\n"}, false},
+		{[]string{"package a\ntype T [N-4]uint8\nconst N = 4\n"}, false},
+		{[]string{"package a\nconst Color = 1\nenum Color\n    0: Red\nend\n"}, false},
+	} {
+		var sources []Source
+		for i, text := range test.texts {
+			sources = append(sources, Source{fmt.Sprintf("%d.speak", i), text})
+		}
+		_, errs := Parse(&Options{Sources: sources})
+		if ok := len(errs) == 0; ok != test.ok {
+			t.Errorf("%q: ok = %v, want %v (%v)", test.texts, ok, test.ok, errs)
+		}
+	}
+	pkgs, errs := Parse(&Options{Sources: []Source{{"a.speak", "package a\ntype T [N]uint8\nconst N = M*2\nconst M = 3\n"}}})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, pkg := range pkgs {
+		if pkg.Name == "a" && (pkg.Types[0].Type.ArraySize != 6 || pkg.Constants[0].Value != 6) {
+			t.Errorf("got array size %d and constant %d, want 6", pkg.Types[0].Type.ArraySize, pkg.Constants[0].Value)
+		}
+	}
+}
+
+// Conditions may be declared by any file of the package.
+func TestCheckConditionsDeclared(t *testing.T) {
+	use := "package a\nmessage M\n    option when = \"debug\"\n    1: x int8 [when=\"debug\"]\nend\n"
+	for _, test := range []struct {
+		texts []string
+		ok    bool
+	}{
+		{[]string{use, "package a\noption conditions = \"debug\"\n"}, true},
+		{[]string{"package a\noption conditions = \"debug\"\n", use}, true},
+		{[]string{use}, false},
+		{[]string{use, "package a\noption conditions = \"factory\"\n"}, false},
+		{[]string{use, "package b\noption conditions = \"debug\"\n"}, false},
+	} {
+		var sources []Source
+		for i, text := range test.texts {
+			sources = append(sources, Source{fmt.Sprintf("%d.speak", i), text})
+		}
+		_, errs := Parse(&Options{Sources: sources})
+		if ok := len(errs) == 0; ok != test.ok {
+			t.Errorf("%q: ok = %v, want %v (%v)", test.texts, ok, test.ok, errs)
+		}
+	}
+}
+
+// The result of parsing does not depend on the order of the files.
+func TestParseFileOrder(t *testing.T) {
+	a := Source{"a.speak", "package p\nmessage B\n    1: x int8 [since=2]\nend\nconst Y = X\n"}
+	b := Source{"b.speak", "package p\noption version = 2\nmessage A\nend\nconst X = 1\n"}
+	var names [2][]string
+	for i, sources := range [][]Source{{a, b}, {b, a}} {
+		pkgs, errs := Parse(&Options{Sources: sources})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		for _, pkg := range pkgs {
+			if pkg.Name != "p" {
+				continue
+			}
+			for _, m := range pkg.Messages {
+				names[i] = append(names[i], m.Name)
+			}
+			for _, c := range pkg.Constants {
+				names[i] = append(names[i], c.Name)
+			}
+		}
+	}
+	if strings.Join(names[0], " ") != "B A Y X" || strings.Join(names[1], " ") != "B A Y X" {
+		t.Errorf("got declarations %v and %v, want B A Y X", names[0], names[1])
+	}
+}
+
+// Undefined types are reported with a hint when a similar type is declared.
+func TestResolveHints(t *testing.T) {
+	b := Source{"b.speak", "package b\nenum Color\n    0: Red\nend\n"}
+	for _, test := range []struct {
+		field string
+		want  string
+	}{
+		{"c RgbColor", "undefined type a.RgbColor, did you mean a.RGBColor"},
+		{"c Color", "undefined type a.Color, did you mean b.Color"},
+		{"c b.Colour", "undefined type b.Colour."},
+		{"c B.Color", "undefined type B.Color, did you mean b.Color"},
+		{"c q.Color", "undefined type q.Color, package q is not imported"},
+		{"c Shade", "undefined type a.Shade."},
+	} {
+		a := Source{"a.speak", "package a\nenum RGBColor\n    0: Red\nend\nmessage M\n    1: " + test.field + "\nend\n"}
+		_, errs := Parse(&Options{Sources: []Source{a, b}})
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), test.want) {
+			t.Errorf("%q: got %v, want %q", test.field, errs, test.want)
+		}
+	}
+}
+
+// Types can not contain themselves by value.
+func TestCheckCycles(t *testing.T) {
+	for _, test := range []struct {
+		text string
+		want string // Reported cycle or "" if valid.
+	}{
+		{"message A\n    1: a A\nend\n", "a.A -> a.A"},
+		{"message A\n    1: b B\nend\nmessage B\n    1: a A\nend\n", "a.A -> a.B -> a.A"},
+		{"message A\n    1: a [2]A\nend\n", "a.A -> a.A"},
+		{"message A\n    1: a optional A\nend\n", "a.A -> a.A"},
+		{"message A\n    1: t T\nend\ntype T A\n", "a.A -> a.T -> a.A"},
+		{"choice C\n    1: A\nend\nmessage A\n    1: c C\nend\n", "a.C -> a.A -> a.C"},
+		{"message A\n    1: a []A\nend\n", ""},
+		{"message A\n    1: m map[string]A\nend\n", ""},
+		{"message A\n    1: b B\nend\nmessage B\n    1: a []A\nend\n", ""},
+	} {
+		_, errs := Parse(&Options{Sources: []Source{{"a.speak", "package a\n" + test.text}}})
+		switch {
+		case test.want == "" && len(errs) > 0:
+			t.Errorf("%q: unexpected errors %v", test.text, errs)
+		case test.want != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), "contains itself: "+test.want+".")):
+			t.Errorf("%q: got %v, want cycle %s", test.text, errs, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolve the type references of all parsed files. Undefined types are
+// reported with a hint if a type of the same name is declared by another
+// package or a type differing only in case is declared. References to types
+// of the referring package are qualified with its name in the syntax trees,
+// after which topic placeholders are checked to refer to enums if they refer
+// to named types. The errors found are returned.
+func (p *Parser) Resolve() []error {
+	decls := make(map[string]*typeDecl)
+	packages := make(map[string]bool)
+	for i := range p.types {
+		t := &p.types[i]
+		decls[t.fqName()] = t
+		packages[t.packageName] = true
+	}
+	var errs []error
+	for i := range p.types {
+		for _, ref := range p.types[i].refs {
+			name := ref.id.PackageName + "." + ref.id.TypeName
+			if decl := decls[name]; decl != nil {
+				if ref.mapKey && decl.kind != ItemEnum {
+					d := ref.errorCtx.Error(fmt.Errorf("map key type %s is not an enum", name))
+					d.Semantic = true
+					errs = append(errs, d)
+				}
+				continue
+			}
+			var err error
+			if hint := p.resolveHint(ref.id, packages[ref.id.PackageName]); hint != "" {
+				err = fmt.Errorf("undefined type %s, did you mean %s", name, hint)
+			} else if !packages[ref.id.PackageName] {
+				err = fmt.Errorf("undefined type %s, package %s is not imported", name, ref.id.PackageName)
+			} else {
+				err = fmt.Errorf("undefined type %s", name)
+			}
+			d := ref.errorCtx.Error(err)
+			d.Semantic = true
+			errs = append(errs, d)
+		}
+	}
+	if len(errs) == 0 {
+		p.qualifyTypes()
+		errs = checkTopicTypes(p.Packages(), decls)
+	}
+	return errs
+}
+
+// Returns the fully qualified name of a declared type that an undefined
+// reference likely was meant to refer to, or "" if there is none. Types
+// differing only in case are preferred over types of the same name in other
+// packages, which are only considered if the referenced package is parsed.
+func (p *Parser) resolveHint(id FqTypeIdentifier, packageParsed bool) string {
+	var other string
+	for i := range p.types {
+		t := &p.types[i]
+		switch {
+		case strings.EqualFold(t.packageName, id.PackageName) && strings.EqualFold(t.name, id.TypeName):
+			return t.fqName()
+		case packageParsed && other == "" && t.name == id.TypeName:
+			other = t.fqName()
+		}
+	}
+	return other
+}
+
+// Qualify references to types of the referring package in the syntax trees.
+func (p *Parser) qualifyTypes() {
+	for _, pkg := range p.packages {
+		var qualify func(ft *FieldType)
+		qualify = func(ft *FieldType) {
+			if ft.Type != nil && ft.Type.PackageName == "" {
+				ft.Type.PackageName = pkg.Name
+			}
+			if ft.Map != nil {
+				qualify(&ft.Map.Key)
+				qualify(&ft.Map.Value)
+			}
+		}
+		for _, m := range pkg.Messages {
+			for _, f := range m.Fields {
+				qualify(&f.Type)
+			}
+		}
+		for _, c := range pkg.Choices {
+			for _, a := range c.Alternatives {
+				qualify(&a.Type)
+			}
+		}
+		for _, t := range pkg.Types {
+			qualify(&t.Type)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+)
+
+// Check that a basic type is allowed by the restrictions of the target.
+func (p *Parser) checkBasicType(item Item) error {
+	if p.NoFloat64 && !p.parsingStd && item.Kind == ItemFloat64 {
+		return errors.New("float64 is not allowed, use float32")
+	}
+	return nil
+}
+
+// Check that strings, dynamic arrays and maps have a fixed capacity when
+// required by the target. Only message fields may set the capacity with a
+// maxlen annotation, which is nil if missing. The item is used for error
+// reporting.
+func (p *Parser) checkCapacity(item Item, ft *FieldType, isField bool, maxlen *Option) bool {
+	if !p.RequireMaxLen || p.parsingStd || ft.Array != ArrayDynamic && ft.Basic != ItemString && ft.Map == nil {
+		return true
+	}
+	if !isField {
+		p.semanticError(item, errors.New("strings and dynamic arrays are only allowed as message fields with a maxlen annotation"))
+		return false
+	}
+	if maxlen == nil {
+		p.semanticError(item, errors.New("field requires a maxlen annotation"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"sort"
+)
+
+// Stats are statistics of compiled schemas, used to review the size and
+// complexity of protocols. The standard package is not included.
+type Stats struct {
+	Packages int // Number of packages declaring types.
+	Messages int // Number of messages.
+	Fields   int // Number of message fields.
+	Choices  int // Number of choices.
+	Enums    int // Number of enums, including anonymous enums.
+	Types    int // Number of custom types.
+
+	// Deepest nesting of types contained by value and the outermost type of
+	// the deepest nesting. A type containing no other types has depth 1.
+	Depth     int
+	DepthType string
+
+	// Messages with the most fields, widest first.
+	Widest []TypeWidth
+
+	// Uses of annotations not known by the compiler by annotation name,
+	// misspelled annotations often show up here.
+	UnknownAnnotations map[string]int
+
+	// Packages referring to or referred to by other packages.
+	Fan []PackageFan
+}
+
+// Number of fields of a message.
+type TypeWidth struct {
+	Name   string // Fully qualified name of the message.
+	Fields int    // Number of fields.
+}
+
+// Dependencies between a package and other packages.
+type PackageFan struct {
+	Name   string // Name of the package.
+	FanIn  int    // Number of packages referring to the package.
+	FanOut int    // Number of packages the package refers to.
+}
+
+// Number of messages listed in Stats.Widest.
+const statsWidest = 5
+
+// Returns statistics of the types parsed so far.
+func (p *Parser) Stats() Stats {
+	var s Stats
+	decls := make(map[string]*typeDecl)
+	packages := make(map[string]bool)
+	fanIn := make(map[string]map[string]bool)
+	fanOut := make(map[string]map[string]bool)
+	for i := range p.types {
+		t := &p.types[i]
+		decls[t.fqName()] = t
+		if t.packageName == stdPackage {
+			continue
+		}
+		packages[t.packageName] = true
+		switch t.kind {
+		case ItemMessage:
+			s.Messages++
+			s.Fields += t.members
+			s.Widest = append(s.Widest, TypeWidth{t.fqName(), t.members})
+		case ItemChoice:
+			s.Choices++
+		case ItemEnum:
+			s.Enums++
+		case ItemType:
+			s.Types++
+		}
+		for _, ref := range t.refs {
+			if ref.id.PackageName == t.packageName || ref.id.PackageName == stdPackage {
+				continue
+			}
+			addEdge(fanOut, t.packageName, ref.id.PackageName)
+			addEdge(fanIn, ref.id.PackageName, t.packageName)
+		}
+	}
+	s.Packages = len(packages)
+	s.Enums += p.inlineEnums
+
+	sort.SliceStable(s.Widest, func(i, j int) bool { return s.Widest[i].Fields > s.Widest[j].Fields })
+	if len(s.Widest) > statsWidest {
+		s.Widest = s.Widest[:statsWidest]
+	}
+
+	// Depth of each type, types are known not to contain themselves.
+	depths := make(map[string]int)
+	var depth func(t *typeDecl) int
+	depth = func(t *typeDecl) int {
+		name := t.fqName()
+		if d, ok := depths[name]; ok {
+			return d
+		}
+		d := 1
+		for _, ref := range t.refs {
+			if refDecl, ok := decls[ref.id.PackageName+"."+ref.id.TypeName]; ok && !ref.dynamic {
+				if rd := depth(refDecl) + 1; rd > d {
+					d = rd
+				}
+			}
+		}
+		depths[name] = d
+		return d
+	}
+	for i := range p.types {
+		if t := &p.types[i]; t.packageName != stdPackage {
+			if d := depth(t); d > s.Depth {
+				s.Depth, s.DepthType = d, t.fqName()
+			}
+		}
+	}
+
+	s.UnknownAnnotations = make(map[string]int)
+	for name, n := range p.unknownAnnotations {
+		s.UnknownAnnotations[name] = n
+	}
+
+	names := make(map[string]bool)
+	for name := range fanIn {
+		names[name] = true
+	}
+	for name := range fanOut {
+		names[name] = true
+	}
+	for name := range names {
+		s.Fan = append(s.Fan, PackageFan{name, len(fanIn[name]), len(fanOut[name])})
+	}
+	sort.Slice(s.Fan, func(i, j int) bool { return s.Fan[i].Name < s.Fan[j].Name })
+	return s
+}
+
+// Add an edge between two packages to a dependency graph.
+func addEdge(graph map[string]map[string]bool, from, to string) {
+	if graph[from] == nil {
+		graph[from] = make(map[string]bool)
+	}
+	graph[from][to] = true
+}
@@ -0,0 +1,32 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	_ "embed"
+)
+
+// The standard package defines well-known types such as timestamps and
+// durations. It's embedded in the compiler and parsed before other files so
+// schemas can refer to its types without passing it to the compiler.
+
+//go:embed std.speak
+var stdSpeak string
+
+const (
+	stdPackage  = "std"       // Name of the standard package.
+	stdFilename = "std.speak" // File name used when reporting errors in it.
+)
+
+// Parse the standard package with the default limits and array size, errors
+// found in it are compiler bugs. It's not cancelled by the parser context. The
+// errors found are returned.
+func (p *Parser) ParseStd() (bool, []error) {
+	limits, maxArraySize, ctx := p.Limits, p.MaxArraySize, p.ctx
+	p.parsingStd, p.Limits, p.MaxArraySize, p.ctx = true, DefaultLimits, DefaultMaxArraySize, nil
+	defer func() { p.parsingStd, p.Limits, p.MaxArraySize, p.ctx = false, limits, maxArraySize, ctx }()
+	return p.ParseText(stdFilename, stdSpeak)
+}
@@ -0,0 +1,23 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import "time"
+
+// Timings are the durations of the phases of a compilation, used to tell
+// whether a slow compilation is bound by reading files or by the compiler.
+type Timings struct {
+	// Reading source files, including imported files.
+	Read time.Duration
+
+	// Lexing and parsing the source files, reading excluded. The lexer runs
+	// concurrently with the parser so the two can not be told apart.
+	Parse time.Duration
+
+	// Resolving type references and the checks involving all files, such as
+	// duplicate and recursive types.
+	Resolve time.Duration
+}
@@ -0,0 +1,104 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Messages carried over MQTT may declare the topic they are published on with
+// the message option "topic". The topic is a template where levels written as
+// "{field}" are replaced by the value of a field of the message
+// ("devices/{deviceId}/status").
+
+// Returns the field name of a placeholder topic level or "" if the level is
+// not a placeholder.
+func topicPlaceholder(level string) string {
+	if strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}") {
+		return level[1 : len(level)-1]
+	}
+	return ""
+}
+
+// Check that value is a topic template.
+func checkTopic(value string) error {
+	if value == "" || strings.HasPrefix(value, "$") {
+		return errors.New("expected topic not beginning with $")
+	}
+	for _, level := range strings.Split(value, "/") {
+		if name := topicPlaceholder(level); name != "" {
+			if !isLittleIdentifier(name) {
+				return fmt.Errorf("invalid placeholder %s, expected field name", level)
+			}
+		} else if strings.ContainsAny(level, "+#{}\x00") {
+			return fmt.Errorf("invalid topic level %q, wildcards and braces are not allowed", level)
+		}
+	}
+	return nil
+}
+
+// Check that the placeholders of a topic template refer to string, integer or
+// enum fields of the message that are neither arrays nor maps. Fields of named
+// types are checked to be enums when resolving types. A nil option is valid.
+func (p *Parser) checkTopicFields(scope *messageScope, topic *Option) bool {
+	if topic == nil {
+		return true
+	}
+	for _, level := range strings.Split(topic.Value, "/") {
+		name := topicPlaceholder(level)
+		if name == "" {
+			continue
+		}
+		f := findField(scope.node, name)
+		if f == nil {
+			p.pushSemanticError(topic.errorCtx, fmt.Errorf("topic placeholder %s is not a field of the message", level))
+			return false
+		}
+		if f.Type.Array != ArrayNone || f.Type.Map != nil || f.Type.Type == nil && f.Type.Enum == nil && !mapKeyTypes[f.Type.Basic] {
+			p.pushSemanticError(topic.errorCtx, fmt.Errorf("topic placeholder %s must be a string, integer or enum field", level))
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the field of a message with the name or nil if there is none.
+func findField(m *Message, name string) *Field {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Check that topic placeholders referring to fields of named types refer to
+// enums. Types must be qualified. The errors found are returned.
+func checkTopicTypes(packages []*Package, decls map[string]*typeDecl) []error {
+	var errs []error
+	for _, pkg := range packages {
+		for _, m := range pkg.Messages {
+			topic := findAnnotation(m.Options, "topic")
+			if topic == nil {
+				continue
+			}
+			for _, level := range strings.Split(topic.Value, "/") {
+				f := findField(m, topicPlaceholder(level))
+				if f == nil || f.Type.Type == nil {
+					continue
+				}
+				if decl := decls[f.Type.Type.String()]; decl != nil && decl.kind != ItemEnum {
+					d := topic.errorCtx.Error(fmt.Errorf("topic placeholder %s refers to type %s which is not an enum", level, f.Type.Type))
+					d.Semantic = true
+					errs = append(errs, d)
+				}
+			}
+		}
+	}
+	return errs
+}
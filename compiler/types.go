@@ -0,0 +1,150 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Declaration of a named type (choice, enum, message or custom type).
+type typeDecl struct {
+	packageName string
+	name        string
+	errorCtx    ErrorCtx
+	kind        ItemKind  // ItemChoice, ItemEnum, ItemMessage or ItemType.
+	members     int       // Number of fields, alternatives or values.
+	refs        []typeRef // Referred types.
+}
+
+// Reference to a named type.
+type typeRef struct {
+	id       FqTypeIdentifier
+	dynamic  bool // The type is the element of a dynamic array or a map value.
+	mapKey   bool // The type is a map key and must be an enum.
+	errorCtx ErrorCtx
+}
+
+// Returns the fully qualified name of the type.
+func (t *typeDecl) fqName() string {
+	return t.packageName + "." + t.name
+}
+
+// Record the previously accepted identifier as a type of the specified kind
+// declared by the current package. Always returns true.
+func (p *Parser) declareType(kind ItemKind) bool {
+	p.types = append(p.types, typeDecl{packageName: p.packageName, name: p.prev.Value, errorCtx: p.errorCtx(p.prev), kind: kind})
+	return true
+}
+
+// Set the number of members of the type being declared.
+func (p *Parser) countMembers(n int) {
+	if len(p.types) > 0 {
+		p.types[len(p.types)-1].members = n
+	}
+}
+
+// Record that the type being declared refers to the previously accepted type
+// identifier id. Always returns true.
+func (p *Parser) referType(id FqTypeIdentifier, ft *FieldType) bool {
+	if len(p.types) == 0 {
+		return true
+	}
+	if id.PackageName == "" {
+		id.PackageName = p.packageName
+	}
+	t := &p.types[len(p.types)-1]
+	t.refs = append(t.refs, typeRef{id: id, dynamic: ft != nil && ft.Array == ArrayDynamic, errorCtx: p.errorCtx(p.prev)})
+	return true
+}
+
+// Returns the type reference recorded last.
+func (p *Parser) lastRef() *typeRef {
+	t := &p.types[len(p.types)-1]
+	return &t.refs[len(t.refs)-1]
+}
+
+// Check that no type contains itself by value, directly or through other
+// types, since such types would have infinite size. Types in dynamic arrays
+// are not contained by value since they are allocated separately. The full
+// path of each cycle is reported at the reference closing it. References to
+// undefined types are ignored. The errors found are returned.
+func (p *Parser) CheckCycles() []error {
+	decls := make(map[string]*typeDecl)
+	for i := range p.types {
+		decls[p.types[i].fqName()] = &p.types[i]
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var errs []error
+	var visit func(t *typeDecl)
+	visit = func(t *typeDecl) {
+		name := t.fqName()
+		state[name] = visiting
+		path = append(path, name)
+		for _, ref := range t.refs {
+			refName := ref.id.PackageName + "." + ref.id.TypeName
+			refDecl, ok := decls[refName]
+			if !ok || ref.dynamic {
+				continue
+			}
+			switch state[refName] {
+			case unvisited:
+				visit(refDecl)
+			case visiting:
+				cycle := path
+				for cycle[0] != refName {
+					cycle = cycle[1:]
+				}
+				d := ref.errorCtx.Error(fmt.Errorf("type %s contains itself: %s -> %s", refName, strings.Join(cycle, " -> "), refName))
+				d.Semantic = true
+				errs = append(errs, d)
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+	}
+	for i := range p.types {
+		if state[p.types[i].fqName()] == unvisited {
+			visit(&p.types[i])
+		}
+	}
+	return errs
+}
+
+// Returns the prefix of C identifiers generated for a package.
+func (p *Parser) cPrefix(packageName string) string {
+	if prefix := p.PackageOption(packageName, "cPrefix"); prefix != "" {
+		return prefix
+	}
+	return strings.ReplaceAll(packageName, ".", "_") + "_"
+}
+
+// Check that the C names of types declared by different packages do not
+// collide, which happens when packages use the same cPrefix or a prefix
+// matching the default prefix of another package. The errors found are
+// returned.
+func (p *Parser) CheckCNames() []error {
+	var errs []error
+	seen := make(map[string]*typeDecl)
+	for i := range p.types {
+		t := &p.types[i]
+		cName := p.cPrefix(t.packageName) + t.name
+		if prev, ok := seen[cName]; ok && prev.packageName != t.packageName {
+			d := t.errorCtx.Error(fmt.Errorf("C name %s collides with %s.%s at %s", cName, prev.packageName, prev.name, prev.errorCtx.Position()))
+			d.Semantic = true
+			errs = append(errs, d)
+			continue
+		}
+		seen[cName] = t
+	}
+	return errs
+}
@@ -1 +1,3 @@
 module github.com/johan-bolmsjo/speak
+
+go 1.24
@@ -0,0 +1,100 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Recover from a panic of the compiler, write a bug report including the
+// speak files to a temporary file and exit with ExitInternal. Must be called
+// deferred.
+func catchPanic(speakFiles []string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	var report bytes.Buffer
+	writeBugReport(&report, r, stack, speakFiles)
+	f, err := os.CreateTemp("", "speakc-bug-*.txt")
+	if err == nil {
+		_, err = f.Write(report.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	fmt.Fprintf(os.Stderr, "speakc: internal compiler error: %v\n", r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write bug report: %s\n%s", err, stack)
+	} else {
+		fmt.Fprintf(os.Stderr, "This is a bug in speakc. A bug report was written to %s,\n"+
+			"please review it and attach it to an issue.\n", f.Name())
+	}
+	os.Exit(ExitInternal)
+}
+
+// Write a bug report of a panic. The speak files are included with comments
+// removed, files that can't be read are noted.
+func writeBugReport(w io.Writer, r interface{}, stack []byte, speakFiles []string) {
+	fmt.Fprintf(w, "%s\n", VersionString())
+	fmt.Fprintf(w, "command: %s\n", strings.Join(os.Args, " "))
+	fmt.Fprintf(w, "panic: %v\n\n%s", r, stack)
+	for _, filename := range speakFiles {
+		fmt.Fprintf(w, "\n==> %s <==\n", filename)
+		data, err := os.ReadFile(filename)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%s\n", err)
+		case len(data) > compiler.DefaultLimits.FileSize:
+			fmt.Fprintf(w, "file too large (%d bytes)\n", len(data))
+		default:
+			io.WriteString(w, stripComments(string(data)))
+		}
+	}
+}
+
+// Returns speak source text without comments, which may contain information
+// not meant to be shared. String literals are kept as is.
+func stripComments(text string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		quoted, escaped := false, false
+		end := len(line)
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case escaped:
+				escaped = false
+			case quoted && c == '\\':
+				escaped = true
+			case c == '"':
+				quoted = !quoted
+			case !quoted && c == '/' && i+1 < len(line) && line[i+1] == '/':
+				end = i
+			}
+			if end != len(line) {
+				break
+			}
+		}
+		if end == len(line) {
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString(strings.TrimRight(line[:end], " \t"))
+		if strings.HasSuffix(line, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
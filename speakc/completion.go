@@ -0,0 +1,165 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Commands of speakc, displayed by the completion scripts.
+var commands = []completionItem{
+	{"completion", "print a shell completion script"},
+	{"registry", "publish and fetch schema versions"},
+}
+
+// Values of flags that take one of a fixed set of arguments.
+var flagValues = map[string][]string{
+	"lang":       {"c", "go"},
+	"field-case": caseNames(),
+	"enum-case":  caseNames(),
+	"profile":    profileNames(),
+	"log-format": {"text", "json"},
+}
+
+// Shells that completion scripts can be printed for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func caseNames() []string {
+	var names []string
+	for c := compiler.CaseAsIs; c <= compiler.CaseUpperSnake; c++ {
+		names = append(names, c.String())
+	}
+	return names
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type completionItem struct {
+	Name        string
+	Description string
+}
+
+// Flag described for the completion scripts.
+type completionFlag struct {
+	completionItem
+	HasArg bool     // The flag takes an argument.
+	Values []string // Possible arguments, any argument is accepted if empty.
+}
+
+// Describe the command line flags for the completion scripts.
+func completionFlags() []completionFlag {
+	var f flags
+	f.define()
+	var cflags []completionFlag
+	flag.VisitAll(func(fl *flag.Flag) {
+		if hiddenFlags[fl.Name] {
+			return
+		}
+		boolFlag, ok := fl.Value.(interface{ IsBoolFlag() bool })
+		cflags = append(cflags, completionFlag{
+			completionItem: completionItem{fl.Name, fl.Usage},
+			HasArg:         !ok || !boolFlag.IsBoolFlag(),
+			Values:         flagValues[fl.Name],
+		})
+	})
+	return cflags
+}
+
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for speakc
+_speakc() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ ${COMP_WORDS[1]} == completion ]]; then
+        [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W "{{join .Shells}}" -- "$cur"))
+        return
+    fi
+    case "$prev" in
+{{- range .Flags}}{{if .HasArg}}
+    -{{.Name}})
+        {{- if .Values}}
+        COMPREPLY=($(compgen -W "{{join .Values}}" -- "$cur"))
+        {{- end}}
+        return;;
+{{- end}}{{end}}
+    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "{{range .Flags}}-{{.Name}} {{end}}" -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(compgen -f -X '!*.speak' -- "$cur") $(compgen -d -- "$cur"))
+    [[ $COMP_CWORD -eq 1 ]] && COMPREPLY+=($(compgen -W "{{range .Commands}}{{.Name}} {{end}}" -- "$cur"))
+}
+complete -o filenames -F _speakc speakc
+`,
+	"zsh": `#compdef speakc
+# zsh completion for speakc
+_speakc() {
+    if [[ $words[2] == completion ]]; then
+        _arguments '2:shell:({{join .Shells}})'
+        return
+    fi
+    (( CURRENT == 2 )) && [[ $PREFIX != -* ]] && compadd -- {{range .Commands}}{{.Name}} {{end}}
+    _arguments \
+{{- range .Flags}}
+        '-{{.Name}}[{{.Description}}]{{if .HasArg}}:{{.Name}}:{{if .Values}}({{join .Values}}){{end}}{{end}}' \
+{{- end}}
+        '*:speak file:_files -g "*.speak"'
+}
+compdef _speakc speakc
+`,
+	"fish": `# fish completion for speakc
+complete -c speakc -f
+complete -c speakc -n '__fish_seen_subcommand_from completion' -a '{{join .Shells}}'
+{{- range .Commands}}
+complete -c speakc -n '__fish_use_subcommand' -a {{.Name}} -d '{{.Description}}'
+{{- end}}
+{{- range .Flags}}
+complete -c speakc -o {{.Name}} -d '{{.Description}}'{{if .HasArg}} -x{{if .Values}} -a '{{join .Values}}'{{end}}{{end}}
+{{- end}}
+complete -c speakc -n 'not __fish_seen_subcommand_from completion' -a '(__fish_complete_suffix .speak)'
+`,
+}
+
+// Print a completion script for the shell named by the first argument.
+func completion(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: speakc completion bash|zsh|fish")
+	}
+	text, ok := completionTemplates[args[0]]
+	if !ok {
+		return fmt.Errorf("unsupported shell '%s'.", args[0])
+	}
+	funcs := template.FuncMap{"join": func(s []string) string { return strings.Join(s, " ") }}
+	tmpl := template.Must(template.New(args[0]).Funcs(funcs).Parse(text))
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		Commands []completionItem
+		Flags    []completionFlag
+		Shells   []string
+	}{commands, completionFlags(), completionShells})
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Exit status of speakc.
+const (
+	ExitOK       = 0 // Success.
+	ExitInternal = 1 // Internal compiler error.
+	ExitUsage    = 2 // Invalid command line usage.
+	ExitSyntax   = 3 // Syntax errors in speak files.
+	ExitSemantic = 4 // Semantic errors in speak files.
+	ExitIO       = 5 // Failure reading or writing files, or a file too large.
+	ExitDiffer   = 6 // Files differ from a registry version (registry diff).
+)
+
+// Returns the exit status for a set of errors. IO errors take precedence over
+// syntax errors which take precedence over semantic errors as the latter are
+// only found in files that could be read and parsed.
+func exitStatus(errs []error) int {
+	status := ExitOK
+	for _, err := range errs {
+		var d *compiler.Diagnostic
+		var pathErr *fs.PathError
+		var sizeErr *compiler.FileSizeError
+		s := ExitSyntax
+		switch {
+		case errors.As(err, &pathErr), errors.As(err, &sizeErr):
+			s = ExitIO
+		case errors.As(err, &d) && d.Semantic:
+			s = ExitSemantic
+		}
+		if status == ExitOK || statusRank(s) > statusRank(status) {
+			status = s
+		}
+	}
+	return status
+}
+
+func statusRank(status int) int {
+	switch status {
+	case ExitIO:
+		return 3
+	case ExitSyntax:
+		return 2
+	case ExitSemantic:
+		return 1
+	}
+	return 0
+}
@@ -9,33 +9,202 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/johan-bolmsjo/speak/compiler"
 )
 
-var usageMessage = `usage: speakc [-h] -lang c|go speak-files
+var usageMessage = `usage: speakc [-h] [-version] [options] -lang c|go speak-files
+       speakc completion bash|zsh|fish
+       speakc registry push|pull|diff|serve [options] [arguments]
 
 Generate serialization code from speak interface definition files.
 
 Options:
-    -h           Display this text.
-    -lang        Generate code for the specified language (c|go).
-    speak-files  Speak source files.
+    -h                Display this text.
+    -version          Display the compiler version and exit.
+    -v                Report progress and timing of the compilation.
+    -debug            Report details useful when debugging the compiler,
+                      implies -v.
+    -q                Only report errors, overrides -v and -debug.
+    -log-format       Format of progress and debug output (text|json,
+                      default text). Errors are not affected.
+    -max-errors       Largest number of errors reported, 0 reports all errors
+                      (default 20).
+    -lang             Generate code for the specified language (c|go).
+    -I                Directory searched for imported speak files, may be
+                      repeated. The directory of the importing file is
+                      searched first.
+    -max-array-size   Largest fixed array size allowed (default 65535).
+    -field-case       Case of message field names in generated code
+                      (as-is|camel|pascal|snake|upper-snake). The default is
+                      as-is for C and pascal for Go.
+    -enum-case        Case of enum value names in generated code
+                      (as-is|camel|pascal|snake|upper-snake). The default is
+                      as-is for C and pascal for Go.
+    -max-file-size    Largest source file size in bytes (default 16777216).
+    -max-tokens       Largest number of tokens in a source file
+                      (default 4194304).
+    -max-depth        Deepest nesting of definitions (default 32).
+    -max-identifier-length
+                      Longest identifier in bytes (default 255).
+    -no-float64       Reject float64 types, for targets without double
+                      precision floating point support.
+    -require-maxlen   Require maxlen annotations on strings and dynamic
+                      arrays, for targets without dynamic memory allocation.
+    -profile          Apply a preset of options, options given explicitly
+                      take precedence (embedded-min|server-go).
+    -out              Directory generated files are written to, created if
+                      needed (default is the current directory).
+    -stdout           Write the generated file to standard output instead,
+                      for code generators producing a single file.
+    -time             Print the time spent reading, parsing and resolving
+                      speak files and writing generated files to standard
+                      error.
+    -stats            Print statistics of the compiled schemas, such as
+                      type counts, nesting depth, widest messages, unknown
+                      annotations and dependencies between packages.
+    speak-files       Speak source files.
+
+Commands:
+    completion        Print a completion script for the specified shell.
+    registry          Publish, fetch and compare schema versions in a schema
+                      registry, see speakc registry -h.
+
+Profiles:
+    embedded-min      Firmware: -lang c -no-float64 -require-maxlen
+                      -max-array-size 4096.
+    server-go         Servers: -lang go.
+
+Exit status:
+    0                 Success.
+    1                 Internal compiler error, a bug report including the
+                      speak files without comments is written to a
+                      temporary file.
+    2                 Invalid command line usage.
+    3                 Syntax errors in speak files.
+    4                 Semantic errors in speak files.
+    5                 Failure reading or writing files, including speak
+                      files larger than -max-file-size.
+    6                 Speak files differ from a registry version
+                      (registry diff).
 
 Example:
 
     speakc -lang c *.speak
+    speakc -profile embedded-min *.speak
+    speakc -lang go -out gen *.speak
 `
 
+// Returned when the help text is requested.
+var errHelp = errors.New("help requested")
+
 type flags struct {
-	help       bool
-	lang       string
-	speakFiles []string
+	help          bool
+	version       bool
+	verbose       bool
+	debug         bool
+	quiet         bool
+	logFormat     string
+	maxErrors     int
+	lang          string
+	maxArraySize  uint64
+	fieldCase     string
+	enumCase      string
+	naming        compiler.Naming
+	limits        compiler.Limits
+	noFloat64     bool
+	requireMaxLen bool
+	profile       string
+	stats         bool
+	time          bool
+	cpuProfile    string
+	memProfile    string
+	traceFile     string
+	out           string
+	stdout        bool
+	includePaths  stringList
+	speakFiles    []string
 }
 
-func (f *flags) Parse() error {
+// Value of a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Option presets selected by -profile, flag values by flag name.
+var profiles = map[string]map[string]string{
+	"embedded-min": {
+		"lang":           "c",
+		"no-float64":     "true",
+		"require-maxlen": "true",
+		"max-array-size": "4096",
+	},
+	"server-go": {
+		"lang": "go",
+	},
+}
+
+// Set the flags of a profile that were not given explicitly.
+func applyProfile(name string) error {
+	profile, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s'.", name)
+	}
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for flagName, value := range profile {
+		if !explicit[flagName] {
+			if err := flag.Set(flagName, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Define the command line flags.
+func (f *flags) define() {
 	flag.BoolVar(&f.help, "h", false, "help message")
+	flag.BoolVar(&f.version, "version", false, "display version")
+	flag.BoolVar(&f.verbose, "v", false, "report progress")
+	flag.BoolVar(&f.debug, "debug", false, "report debug information")
+	flag.BoolVar(&f.quiet, "q", false, "only report errors")
+	flag.StringVar(&f.logFormat, "log-format", "text", "format of progress and debug output")
+	flag.IntVar(&f.maxErrors, "max-errors", 20, "largest number of errors reported")
 	flag.StringVar(&f.lang, "lang", "", "language to generate code for")
+	flag.Var(&f.includePaths, "I", "directory searched for imported files")
+	flag.Uint64Var(&f.maxArraySize, "max-array-size", compiler.DefaultMaxArraySize, "largest fixed array size")
+	flag.StringVar(&f.fieldCase, "field-case", "", "case of message field names")
+	flag.StringVar(&f.enumCase, "enum-case", "", "case of enum value names")
+	flag.IntVar(&f.limits.FileSize, "max-file-size", compiler.DefaultLimits.FileSize, "largest source file size")
+	flag.IntVar(&f.limits.Tokens, "max-tokens", compiler.DefaultLimits.Tokens, "largest number of tokens")
+	flag.IntVar(&f.limits.Depth, "max-depth", compiler.DefaultLimits.Depth, "deepest nesting of definitions")
+	flag.IntVar(&f.limits.IdentifierLength, "max-identifier-length", compiler.DefaultLimits.IdentifierLength, "longest identifier")
+	flag.BoolVar(&f.noFloat64, "no-float64", false, "reject float64 types")
+	flag.BoolVar(&f.requireMaxLen, "require-maxlen", false, "require maxlen annotations")
+	flag.StringVar(&f.profile, "profile", "", "preset of options")
+	flag.BoolVar(&f.stats, "stats", false, "print schema statistics")
+	flag.BoolVar(&f.time, "time", false, "print the time spent per phase")
+	flag.StringVar(&f.cpuProfile, "cpuprofile", "", "write a CPU profile of the compilation to file")
+	flag.StringVar(&f.memProfile, "memprofile", "", "write a heap profile after the compilation to file")
+	flag.StringVar(&f.traceFile, "trace", "", "write an execution trace of the compilation to file")
+	flag.StringVar(&f.out, "out", "", "output directory")
+	flag.BoolVar(&f.stdout, "stdout", false, "write the generated file to standard output")
+}
+
+func (f *flags) Parse() error {
+	f.define()
 
 	err := error(nil)
 	flag.Usage = func() {
@@ -45,7 +214,15 @@ func (f *flags) Parse() error {
 		return err
 	}
 	if f.help {
-		return errors.New(usageMessage)
+		return errHelp
+	}
+	if f.version {
+		return nil
+	}
+	if f.profile != "" {
+		if err := applyProfile(f.profile); err != nil {
+			return err
+		}
 	}
 
 	var missing []string
@@ -59,6 +236,33 @@ func (f *flags) Parse() error {
 	if f.lang != "c" && f.lang != "go" {
 		return fmt.Errorf("unsupported target language '%s'.", f.lang)
 	}
+	if f.logFormat != "text" && f.logFormat != "json" {
+		return fmt.Errorf("unsupported log format '%s'.", f.logFormat)
+	}
+	if f.stdout && (f.out != "" || f.stats) {
+		return errors.New("-stdout can not be combined with -out or -stats.")
+	}
+	if f.maxErrors < 0 {
+		return errors.New("-max-errors must not be negative.")
+	}
+	if f.maxArraySize == 0 {
+		return errors.New("-max-array-size must be a positive number.")
+	}
+	if f.limits.FileSize <= 0 || f.limits.Tokens <= 0 || f.limits.Depth <= 0 || f.limits.IdentifierLength <= 0 {
+		return errors.New("-max-file-size, -max-tokens, -max-depth and -max-identifier-length must be positive numbers.")
+	}
+
+	f.naming = compiler.DefaultNaming(f.lang)
+	if f.fieldCase != "" {
+		if f.naming.Field, err = compiler.ParseCase(f.fieldCase); err != nil {
+			return err
+		}
+	}
+	if f.enumCase != "" {
+		if f.naming.EnumValue, err = compiler.ParseCase(f.enumCase); err != nil {
+			return err
+		}
+	}
 
 	for _, arg := range flag.Args() {
 		f.speakFiles = append(f.speakFiles, arg)
@@ -67,20 +271,111 @@ func (f *flags) Parse() error {
 	return nil
 }
 
+// Returns a logger writing progress (-v) or debug information (-debug) to
+// standard error in the format selected by -log-format.
+func newLogger(f *flags) *slog.Logger {
+	level := slog.LevelWarn
+	switch {
+	case f.quiet:
+	case f.debug:
+		level = slog.LevelDebug
+	case f.verbose:
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if f.logFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		if err := completion(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(ExitUsage)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "registry" {
+		os.Exit(registry(os.Args[2:]))
+	}
+
 	var f flags
-	if err := f.Parse(); err != nil {
+	if err := f.Parse(); err == errHelp {
+		fmt.Print(usageMessage)
+		return
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
+		os.Exit(ExitUsage)
 	}
+	if f.version {
+		fmt.Println(VersionString())
+		return
+	}
+	defer catchPanic(f.speakFiles)
+
+	logger := newLogger(&f)
+	logger.Debug("starting", "version", VersionString())
 
-	parser := new(Parser)
-	for _, filename := range f.speakFiles {
-		if ok, errors := parser.ParseFile(filename); !ok {
-			for _, err := range errors {
-				fmt.Fprintf(os.Stderr, "%s\n", err)
+	var stats *compiler.Stats
+	if f.stats {
+		stats = new(compiler.Stats)
+	}
+	var timings *compiler.Timings
+	if f.time {
+		timings = new(compiler.Timings)
+	}
+	stopProfiling, err := startProfiling(&f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(ExitIO)
+	}
+	start := time.Now()
+	files, errs := compiler.Compile(&compiler.Options{
+		Lang:          f.lang,
+		Naming:        f.naming,
+		MaxArraySize:  f.maxArraySize,
+		Limits:        f.limits,
+		Logger:        logger,
+		NoFloat64:     f.noFloat64,
+		RequireMaxLen: f.requireMaxLen,
+		Stats:         stats,
+		Timings:       timings,
+		Filenames:     f.speakFiles,
+		IncludePaths:  f.includePaths,
+	})
+	if err := stopProfiling(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(ExitIO)
+	}
+	if len(errs) > 0 {
+		for i, err := range errs {
+			if f.maxErrors > 0 && i == f.maxErrors {
+				fmt.Fprintf(os.Stderr, "too many errors (%d more not shown)\n", len(errs)-i)
+				break
 			}
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		if timings != nil {
+			writeTimings(os.Stderr, timings, 0, time.Since(start))
 		}
+		os.Exit(exitStatus(errs))
+	}
+	writeStart := time.Now()
+	if f.stdout {
+		err = writeSingleFile(os.Stdout, files)
+	} else {
+		err = writeFiles(f.out, files)
+	}
+	if timings != nil {
+		writeTimings(os.Stderr, timings, time.Since(writeStart), time.Since(start))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(outputStatus(err))
+	}
+	if stats != nil {
+		writeStats(os.Stdout, stats)
 	}
 }
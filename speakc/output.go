@@ -0,0 +1,47 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Write generated files below a directory, subdirectories are created as
+// needed.
+func writeFiles(dir string, files compiler.Files) error {
+	if dir == "" {
+		dir = "."
+	}
+	return files.Write(compiler.DirFS(dir))
+}
+
+// Write the contents of a single generated file to w.
+func writeSingleFile(w io.Writer, files compiler.Files) error {
+	if len(files) > 1 {
+		return fmt.Errorf("-stdout requires a single generated file, %d were generated", len(files))
+	}
+	for _, file := range files {
+		if _, err := w.Write(file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the exit status for an error writing generated files. Invalid file
+// names and errors other than IO errors are caused by code generators.
+func outputStatus(err error) int {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && !errors.Is(err, fs.ErrInvalid) {
+		return ExitIO
+	}
+	return ExitInternal
+}
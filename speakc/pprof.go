@@ -0,0 +1,80 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Flags for profiling the compiler, left out of the usage text and the
+// completion scripts since they are meant for maintainers.
+var hiddenFlags = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+	"trace":      true,
+}
+
+// Start the CPU profile and execution trace requested by -cpuprofile and
+// -trace. The returned function stops them and writes the heap profile
+// requested by -memprofile.
+func startProfiling(f *flags) (func() error, error) {
+	var cpuFile, traceFile *os.File
+	closeAll := func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if traceFile != nil {
+			trace.Stop()
+			traceFile.Close()
+		}
+	}
+	if f.cpuProfile != "" {
+		file, err := os.Create(f.cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", f.cpuProfile, err)
+		}
+		cpuFile = file
+	}
+	if f.traceFile != "" {
+		file, err := os.Create(f.traceFile)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if err := trace.Start(file); err != nil {
+			file.Close()
+			closeAll()
+			return nil, fmt.Errorf("%s: %w", f.traceFile, err)
+		}
+		traceFile = file
+	}
+	stop := func() error {
+		closeAll()
+		if f.memProfile == "" {
+			return nil
+		}
+		file, err := os.Create(f.memProfile)
+		if err != nil {
+			return err
+		}
+		runtime.GC()
+		err = pprof.WriteHeapProfile(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return stop, nil
+}
@@ -0,0 +1,484 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// The schema registry stores published versions of packages. A version is
+// identified by the package name and its schema version (option version) and
+// can not be changed once published. The HTTP API has a single resource:
+//
+//	PUT /packages/<package>/versions/<version>   Publish a version.
+//	GET /packages/<package>/versions/<version>   Fetch a version.
+//
+// Both use a JSON object with the source files of the version by file name
+// ({"files": {"paint.speak": "package paint\n..."}}) as body.
+
+var registryUsageMessage = `usage: speakc registry push [-url url] speak-files
+       speakc registry pull [-url url] [-o dir] package version
+       speakc registry diff [-url url] package version speak-files
+       speakc registry serve [-addr addr] [-dir dir]
+
+Publish, fetch and compare schema versions in a schema registry.
+
+Commands:
+    push              Publish the package defined by the speak files, all
+                      files must belong to the same package and declare its
+                      schema version.
+    pull              Fetch a version of a package into a directory.
+    diff              Report differences between the speak files and a
+                      version of a package, the exit status is 6 if they
+                      differ.
+    serve             Run a registry server storing versions in a directory.
+
+Options:
+    -url              Registry URL, the default is taken from the
+                      SPEAKC_REGISTRY environment variable.
+    -o                Directory to write fetched files to (default ".").
+    -addr             Address to listen on (default ":8080").
+    -dir              Directory to store versions in (default ".").
+`
+
+// Maximum size of a registry request or response body.
+const maxRegistryBody = 64 << 20
+
+// Source files of a package version.
+type registryVersion struct {
+	Files map[string]string `json:"files"`
+}
+
+var (
+	registryPackagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(\.[A-Za-z][A-Za-z0-9]*)*$`)
+	registryVersionPattern = regexp.MustCompile(`^[1-9][0-9]{0,9}$`)
+)
+
+// Run a registry command and return the exit status.
+func registry(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, registryUsageMessage)
+		return ExitUsage
+	}
+	if args[0] == "-h" {
+		fmt.Print(registryUsageMessage)
+		return ExitOK
+	}
+	fs := flag.NewFlagSet("registry "+args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	url := fs.String("url", os.Getenv("SPEAKC_REGISTRY"), "registry URL")
+	var run func() error
+	switch args[0] {
+	case "push":
+		run = func() error { return registryPush(*url, fs.Args()) }
+	case "pull":
+		dir := fs.String("o", ".", "directory to write files to")
+		run = func() error { return registryPull(*url, *dir, fs.Args()) }
+	case "diff":
+		run = func() error { return registryDiff(*url, fs.Args()) }
+	case "serve":
+		addr := fs.String("addr", ":8080", "address to listen on")
+		dir := fs.String("dir", ".", "directory to store versions in")
+		run = func() error { return registryServe(*addr, *dir) }
+	default:
+		fmt.Fprintf(os.Stderr, "unknown registry command '%s'.\n", args[0])
+		return ExitUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n%s", err, registryUsageMessage)
+		return ExitUsage
+	}
+	if args[0] != "serve" && *url == "" {
+		fmt.Fprintf(os.Stderr, "missing argument(s): -url\n")
+		return ExitUsage
+	}
+	// Only push and diff take speak files, diff after the package and version.
+	var speakFiles []string
+	switch {
+	case args[0] == "push":
+		speakFiles = fs.Args()
+	case args[0] == "diff" && fs.NArg() > 2:
+		speakFiles = fs.Args()[2:]
+	}
+	defer catchPanic(speakFiles)
+	err := run()
+	var usage registryUsageError
+	var diag diagnosticsError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, errRegistryDiffer):
+		return ExitDiffer
+	case errors.As(err, &usage):
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return ExitUsage
+	case errors.As(err, &diag):
+		for _, e := range compiler.SortErrors(diag) {
+			fmt.Fprintf(os.Stderr, "%s\n", e)
+		}
+		return exitStatus(diag)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	return ExitIO
+}
+
+// Invalid arguments of a registry command.
+type registryUsageError string
+
+func (e registryUsageError) Error() string { return string(e) }
+
+// Returned by registry diff when the speak files differ, the differences have
+// already been reported.
+var errRegistryDiffer = errors.New("files differ")
+
+// Errors found in speak files.
+type diagnosticsError []error
+
+func (e diagnosticsError) Error() string { return fmt.Sprintf("%d errors in speak files", len(e)) }
+
+// Parse speak files belonging to one package and return its name, schema
+// version and the files by base name.
+func registryLoad(speakFiles []string) (string, string, *registryVersion, error) {
+	if len(speakFiles) == 0 {
+		return "", "", nil, registryUsageError("missing speak files")
+	}
+	parser := &compiler.Parser{}
+	version := &registryVersion{Files: make(map[string]string)}
+	var errs []error
+	packageName := ""
+	for _, filename := range speakFiles {
+		if ok, fileErrs := parser.ParseFile(filename); !ok {
+			errs = append(errs, fileErrs...)
+			continue
+		}
+		// The file may already have been parsed as an import of a previous
+		// file, the package of the parser is then that of the previous file.
+		filePackage := parser.FilePackageName(filename)
+		if packageName != "" && filePackage != packageName {
+			return "", "", nil, fmt.Errorf("%s: package %s, expected %s", filename, filePackage, packageName)
+		}
+		packageName = filePackage
+		name := filepath.Base(filename)
+		if _, ok := version.Files[name]; ok {
+			return "", "", nil, fmt.Errorf("%s: file name used more than once", filename)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return "", "", nil, err
+		}
+		version.Files[name] = string(data)
+	}
+	if len(errs) > 0 {
+		return "", "", nil, diagnosticsError(errs)
+	}
+	schemaVersion := parser.PackageOption(packageName, "version")
+	if schemaVersion == "" {
+		return "", "", nil, fmt.Errorf("package %s does not declare its schema version (option version)", packageName)
+	}
+	return packageName, schemaVersion, version, nil
+}
+
+// Returns the URL of a package version.
+func registryURL(url, packageName, version string) (string, error) {
+	if !registryPackagePattern.MatchString(packageName) {
+		return "", registryUsageError(fmt.Sprintf("invalid package name '%s'.", packageName))
+	}
+	if !registryVersionPattern.MatchString(version) {
+		return "", registryUsageError(fmt.Sprintf("invalid version '%s'.", version))
+	}
+	return strings.TrimSuffix(url, "/") + "/packages/" + packageName + "/versions/" + version, nil
+}
+
+var registryClient = &http.Client{Timeout: time.Minute}
+
+// Perform a registry request and decode the response body into v unless it's
+// nil.
+func registryRequest(method, url string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRegistryBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, bytes.TrimSpace(data))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Fetch a package version.
+func registryFetch(url, packageName, version string) (*registryVersion, error) {
+	versionURL, err := registryURL(url, packageName, version)
+	if err != nil {
+		return nil, err
+	}
+	var v registryVersion
+	if err := registryRequest("GET", versionURL, nil, &v); err != nil {
+		return nil, err
+	}
+	for name := range v.Files {
+		if !validRegistryFileName(name) {
+			return nil, fmt.Errorf("%s: invalid file name '%s'.", versionURL, name)
+		}
+	}
+	return &v, nil
+}
+
+func registryPush(url string, args []string) error {
+	packageName, version, v, err := registryLoad(args)
+	if err != nil {
+		return err
+	}
+	versionURL, err := registryURL(url, packageName, version)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := registryRequest("PUT", versionURL, body, nil); err != nil {
+		return err
+	}
+	fmt.Printf("pushed %s version %s\n", packageName, version)
+	return nil
+}
+
+func registryPull(url, dir string, args []string) error {
+	if len(args) != 2 {
+		return registryUsageError("usage: speakc registry pull [-url url] [-o dir] package version")
+	}
+	v, err := registryFetch(url, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	for _, name := range sortedFileNames(v.Files) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(v.Files[name]), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registryDiff(url string, args []string) error {
+	if len(args) < 3 {
+		return registryUsageError("usage: speakc registry diff [-url url] package version speak-files")
+	}
+	local := make(map[string]string)
+	for _, filename := range args[2:] {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		local[filepath.Base(filename)] = string(data)
+	}
+	v, err := registryFetch(url, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	names := sortedFileNames(v.Files)
+	for name := range local {
+		if _, ok := v.Files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	differ := false
+	for _, name := range names {
+		remote, inRegistry := v.Files[name]
+		text, inLocal := local[name]
+		switch {
+		case !inLocal:
+			fmt.Printf("only in registry: %s\n", name)
+		case !inRegistry:
+			fmt.Printf("only in local files: %s\n", name)
+		case remote != text:
+			fmt.Printf("--- %s (registry %s version %s)\n+++ %s\n", name, args[0], args[1], name)
+			fmt.Print(lineDiff(remote, text))
+		default:
+			continue
+		}
+		differ = true
+	}
+	if differ {
+		return errRegistryDiffer
+	}
+	return nil
+}
+
+func sortedFileNames(files map[string]string) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Maximum product of line counts compared line by line, larger files are
+// only reported as different.
+const maxLineDiff = 1 << 22
+
+// Returns the differing lines of two texts, removed lines prefixed by "-"
+// and added lines by "+".
+func lineDiff(a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+	if len(x)*len(y) > maxLineDiff {
+		return "files differ\n"
+	}
+	// Longest common subsequence lengths of the suffixes of x and y.
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var buf strings.Builder
+	line := func(prefix, s string) {
+		buf.WriteString(prefix + strings.TrimSuffix(s, "\n") + "\n")
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i, j = i+1, j+1
+		case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+			line("-", x[i])
+			i++
+		default:
+			line("+", y[j])
+			j++
+		}
+	}
+	return buf.String()
+}
+
+// Returns the lines of a text including their line endings.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Reports whether name is a plain file name as stored in the registry.
+func validRegistryFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// Registry server storing each version as a JSON file in a directory
+// ("<dir>/<package>/<version>.json").
+type registryServer struct {
+	dir string
+	mu  sync.Mutex // Serializes publishing.
+}
+
+func registryServe(addr, dir string) error {
+	s := &registryServer{dir: dir}
+	server := &http.Server{Addr: addr, Handler: s, ReadHeaderTimeout: time.Minute}
+	fmt.Fprintf(os.Stderr, "speakc: serving registry in %s on %s\n", dir, addr)
+	return server.ListenAndServe()
+}
+
+func (s *registryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "packages" || parts[2] != "versions" ||
+		!registryPackagePattern.MatchString(parts[1]) || !registryVersionPattern.MatchString(parts[3]) {
+		http.NotFound(w, r)
+		return
+	}
+	filename := filepath.Join(s.dir, parts[1], parts[3]+".json")
+	switch r.Method {
+	case "GET":
+		data, err := os.ReadFile(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, "failed to read version", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case "PUT":
+		s.publish(w, r, filename)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Store a published version. Publishing the same files again succeeds,
+// versions can otherwise not be changed.
+func (s *registryServer) publish(w http.ResponseWriter, r *http.Request, filename string) {
+	var v registryVersion
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRegistryBody)).Decode(&v); err != nil || len(v.Files) == 0 {
+		http.Error(w, "expected JSON object with files", http.StatusBadRequest)
+		return
+	}
+	for name := range v.Files {
+		if !validRegistryFileName(name) {
+			http.Error(w, fmt.Sprintf("invalid file name %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	data, err := json.Marshal(&v)
+	if err != nil {
+		http.Error(w, "failed to encode version", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, err := os.ReadFile(filename); err == nil {
+		if !bytes.Equal(prev, data) {
+			http.Error(w, "version already published with different files", http.StatusConflict)
+		}
+		return
+	}
+	if err := compiler.DirFS(filepath.Dir(filename)).WriteFile(filepath.Base(filename), data); err != nil {
+		http.Error(w, "failed to store version", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
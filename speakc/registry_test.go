@@ -0,0 +1,147 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Requests to the registry server in order, each against the state left by
+// the previous ones.
+func TestRegistryServeHTTP(t *testing.T) {
+	s := &registryServer{dir: t.TempDir()}
+	paint := `{"files":{"paint.speak":"package paint\n"}}`
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/packages/paint/versions/1", "", http.StatusNotFound},
+		{"PUT", "/packages/paint/versions/1", paint, http.StatusCreated},
+		{"GET", "/packages/paint/versions/1", "", http.StatusOK},
+		{"PUT", "/packages/paint/versions/1", paint, http.StatusOK},
+		{"PUT", "/packages/paint/versions/1", `{"files":{"paint.speak":"package paint\n// changed\n"}}`, http.StatusConflict},
+		{"PUT", "/packages/paint/versions/2", `{"files":{}}`, http.StatusBadRequest},
+		{"PUT", "/packages/paint/versions/2", `not json`, http.StatusBadRequest},
+		{"PUT", "/packages/paint/versions/2", `{"files":{"../paint.speak":"package paint\n"}}`, http.StatusBadRequest},
+		{"PUT", "/packages/paint/versions/2", `{"files":{"a\\b.speak":"package paint\n"}}`, http.StatusBadRequest},
+		{"GET", "/packages/paint/versions/2", "", http.StatusNotFound},
+		{"DELETE", "/packages/paint/versions/1", "", http.StatusMethodNotAllowed},
+		{"GET", "/packages/../versions/1", "", http.StatusNotFound},
+		{"GET", "/packages/paint/versions/01", "", http.StatusNotFound},
+		{"GET", "/packages/paint/versions/1/files", "", http.StatusNotFound},
+		{"GET", "/packages/paint..x/versions/1", "", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s %s %s: status %d, expected %d", test.method, test.path, test.body, w.Code, test.status)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, "paint", "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != paint {
+		t.Errorf("stored %s, expected %s", data, paint)
+	}
+}
+
+// A version fetched from the server is the published version.
+func TestRegistryFetch(t *testing.T) {
+	server := httptest.NewServer(&registryServer{dir: t.TempDir()})
+	defer server.Close()
+	if err := registryRequest("PUT", server.URL+"/packages/paint/versions/1", []byte(`{"files":{"paint.speak":"package paint\n"}}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	v, err := registryFetch(server.URL, "paint", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Files) != 1 || v.Files["paint.speak"] != "package paint\n" {
+		t.Errorf("fetched %v", v.Files)
+	}
+	if _, err := registryFetch(server.URL, "paint", "2"); err == nil {
+		t.Error("expected an error fetching an unpublished version")
+	}
+	if _, err := registryFetch(server.URL, "../paint", "1"); err == nil {
+		t.Error("expected an error for an invalid package name")
+	}
+}
+
+func TestValidRegistryFileName(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		valid bool
+	}{
+		{"paint.speak", true},
+		{".speak", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"a/paint.speak", false},
+		{"/paint.speak", false},
+		{"../paint.speak", false},
+		{`a\paint.speak`, false},
+	} {
+		if valid := validRegistryFileName(test.name); valid != test.valid {
+			t.Errorf("%q: valid = %v, expected %v", test.name, valid, test.valid)
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b, diff string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"a\nb\n", "a\nc\n", "-b\n+c\n"},
+		{"a\n", "a\nb\n", "+b\n"},
+		{"a\nb\n", "b\n", "-a\n"},
+		{"a\nb\nc\n", "a\nx\nc\n", "-b\n+x\n"},
+		{"a", "a\n", "-a\n+a\n"},
+		{"", "a\n", "+a\n"},
+	} {
+		if diff := lineDiff(test.a, test.b); diff != test.diff {
+			t.Errorf("lineDiff(%q, %q) = %q, expected %q", test.a, test.b, diff, test.diff)
+		}
+	}
+	large := strings.Repeat("a\n", 3000)
+	if diff := lineDiff(large, large+"b\n"); diff != "files differ\n" {
+		t.Errorf("large files: %q", diff)
+	}
+}
+
+// Files already parsed as imports of previous files are checked to belong to
+// the package too.
+func TestRegistryLoadPackage(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{
+		"a.speak": "package a\noption version = 1\nimport \"b.speak\"\n",
+		"b.speak": "package b\noption version = 1\n",
+		"c.speak": "package a\noption version = 1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := filepath.Join(dir, "a.speak"), filepath.Join(dir, "b.speak"), filepath.Join(dir, "c.speak")
+	if _, _, _, err := registryLoad([]string{a, b}); err == nil {
+		t.Error("expected an error for files of different packages")
+	}
+	packageName, version, v, err := registryLoad([]string{a, c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packageName != "a" || version != "1" || len(v.Files) != 2 {
+		t.Errorf("loaded package %s version %s files %v", packageName, version, v.Files)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Write a schema statistics report.
+func writeStats(w io.Writer, s *compiler.Stats) {
+	fmt.Fprintf(w, "packages             %d\n", s.Packages)
+	fmt.Fprintf(w, "messages             %d\n", s.Messages)
+	fmt.Fprintf(w, "fields               %d\n", s.Fields)
+	fmt.Fprintf(w, "choices              %d\n", s.Choices)
+	fmt.Fprintf(w, "enums                %d\n", s.Enums)
+	fmt.Fprintf(w, "types                %d\n", s.Types)
+	if s.Depth > 0 {
+		fmt.Fprintf(w, "deepest nesting      %d (%s)\n", s.Depth, s.DepthType)
+	}
+	if len(s.Widest) > 0 {
+		fmt.Fprintf(w, "widest messages (fields):\n")
+		for _, m := range s.Widest {
+			fmt.Fprintf(w, "    %-32s %d\n", m.Name, m.Fields)
+		}
+	}
+	if len(s.UnknownAnnotations) > 0 {
+		var names []string
+		for name := range s.UnknownAnnotations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "unknown annotations:\n")
+		for _, name := range names {
+			fmt.Fprintf(w, "    %-32s %d\n", name, s.UnknownAnnotations[name])
+		}
+	}
+	if len(s.Fan) > 0 {
+		fmt.Fprintf(w, "package fan-in/fan-out:\n")
+		for _, f := range s.Fan {
+			fmt.Fprintf(w, "    %-32s %d/%d\n", f.Name, f.FanIn, f.FanOut)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/johan-bolmsjo/speak/compiler"
+)
+
+// Write the durations of the compilation phases, the time spent writing
+// generated files and the total time of the compilation.
+func writeTimings(w io.Writer, t *compiler.Timings, write, total time.Duration) {
+	fmt.Fprintf(w, "read                 %v\n", t.Read)
+	fmt.Fprintf(w, "parse                %v\n", t.Parse)
+	fmt.Fprintf(w, "resolve              %v\n", t.Resolve)
+	fmt.Fprintf(w, "write                %v\n", write)
+	fmt.Fprintf(w, "total                %v\n", total)
+}
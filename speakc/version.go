@@ -0,0 +1,45 @@
+// Copyright 2014 Johan Bolmsjö
+//
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+const (
+	// Version of the compiler.
+	Version = "0.1.0"
+
+	// Version of the language specification implemented by the compiler.
+	SpecVersion = "1"
+)
+
+// Returns the version control revision the compiler was built from, or
+// "unknown" if the information is not available. A "-dirty" suffix is added
+// if the working tree had local modifications.
+func Revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, dirty := "unknown", ""
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision":
+			revision = setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true":
+			dirty = "-dirty"
+		}
+	}
+	return revision + dirty
+}
+
+// Returns a one line description of the compiler version intended to be
+// printed to users and embedded in generated files.
+func VersionString() string {
+	return fmt.Sprintf("speakc %s (speak spec %s, revision %s)", Version, SpecVersion, Revision())
+}